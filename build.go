@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/watch"
+)
+
+type BuildErrors struct {
+	Errors []djsbuilder.FileError `json:"errors"`
+}
+
+// runBuild implements `djs build <srcdir> -outdir <dir>`, which transpiles a
+// whole directory tree.
+func runBuild(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	var outDir string
+	var sourceMap bool
+	var inlineSources bool
+	var jsonOutput bool
+	var downlevel bool
+	var preserveComments bool
+	var stripAsserts bool
+	var moduleFormat string
+	var jobs int
+	var watchMode bool
+	fs.StringVar(&outDir, "outdir", "", "Output directory (required)")
+	fs.BoolVar(&sourceMap, "sourcemap", true, "Write a source map (.map) next to each output file")
+	fs.BoolVar(&inlineSources, "inline-sources", false, "Include source content in source maps")
+	fs.BoolVar(&jsonOutput, "json", false, "Output errors in JSON format")
+	fs.BoolVar(&downlevel, "downlevel", false, "Emit explicit null checks instead of ?., ?? and ??= (Node.js < 14)")
+	fs.StringVar(&moduleFormat, "module", djsbuilder.ModuleCommonJS, "Output format of import/export: cjs or esm")
+	fs.BoolVar(&preserveComments, "preserve-comments", false, "Keep license headers and JSDoc comments in the output")
+	fs.BoolVar(&stripAsserts, "strip-asserts", false, "Remove assert statements from the output (release builds)")
+	fs.IntVar(&jobs, "j", 0, "Number of files transpiled in parallel (default: number of CPUs)")
+	fs.BoolVar(&watchMode, "watch", false, "Rebuild the files that change until interrupted")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: djs build [options] <srcdir> -outdir <dir>")
+		fmt.Fprintln(os.Stderr, "\nTranspiles every .djs file under srcdir into a mirrored tree under outdir,")
+		fmt.Fprintln(os.Stderr, "and copies the other files. Hidden directories and node_modules are skipped.")
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nExamples:")
+		fmt.Fprintln(os.Stderr, "  djs build src/ -outdir dist/                                    # Build a project")
+		fmt.Fprintln(os.Stderr, "  djs build src/ -outdir dist/ --module esm                       # Emit ES modules (.mjs)")
+		fmt.Fprintln(os.Stderr, "  djs build src/ -outdir dist/ --json                             # Report errors as JSON")
+		fmt.Fprintln(os.Stderr, "  djs build src/ -outdir dist/ --watch                            # Rebuild on changes")
+	}
+
+	// flags may come before or after the source directory
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: build requires exactly one source directory")
+		fs.Usage()
+		return 2
+	}
+	if outDir == "" {
+		fmt.Fprintln(os.Stderr, "Error: build requires -outdir")
+		return 2
+	}
+	if moduleFormat != djsbuilder.ModuleCommonJS && moduleFormat != djsbuilder.ModuleESM {
+		fmt.Fprintf(os.Stderr, "Error: --module must be %q or %q\n", djsbuilder.ModuleCommonJS, djsbuilder.ModuleESM)
+		return 2
+	}
+	if inlineSources && !sourceMap {
+		fmt.Fprintln(os.Stderr, "Error: --inline-sources requires source maps")
+		return 2
+	}
+	srcDir := positional[0]
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", srcDir)
+		return 2
+	}
+
+	opts := djsbuilder.BuildOptions{
+		Options: djsbuilder.Options{
+			Downlevel:        downlevel,
+			PreserveComments: preserveComments,
+			Module:           moduleFormat,
+			StripAsserts:     stripAsserts,
+		},
+		SourceMap:     sourceMap,
+		InlineSources: inlineSources,
+		Jobs:          jobs,
+	}
+	result, err := djsbuilder.Build(srcDir, outDir, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", srcDir, err)
+		return 1
+	}
+	if !reportBuild(result, jsonOutput) {
+		return 1
+	}
+	if watchMode {
+		return watchBuild(srcDir, outDir, opts, jsonOutput)
+	}
+	if len(result.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportBuild prints the errors and a summary of a build, and reports whether
+// the report could be written.
+func reportBuild(result *djsbuilder.BuildResult, jsonOutput bool) bool {
+	if jsonOutput {
+		errs := BuildErrors{Errors: result.Errors}
+		if errs.Errors == nil {
+			errs.Errors = []djsbuilder.FileError{}
+		}
+		jsonBytes, jerr := json.MarshalIndent(errs, "", "  ")
+		if jerr != nil {
+			fmt.Fprintf(os.Stderr, "Error serializing error response: %v\n", jerr)
+			return false
+		}
+		fmt.Fprintln(os.Stdout, string(jsonBytes))
+		return true
+	}
+	for _, ferr := range result.Errors {
+		if ferr.Code == djsbuilder.ErrorCodeIO {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", ferr.File, ferr.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", ferr.File, ferr.Position.Line, ferr.Position.Column, ferr.Message)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Built %d files, copied %d assets, %d errors\n", result.Files, result.Assets, len(result.Errors))
+	return true
+}
+
+// watchBuild rebuilds the files under srcDir that change, and removes the
+// output of deleted files, until djs is interrupted.
+func watchBuild(srcDir, outDir string, opts djsbuilder.BuildOptions, jsonOutput bool) int {
+	w := &watch.Watcher{
+		Interval: watchInterval,
+		Debounce: watchDebounce,
+		List: func() []string {
+			sources, assets, _ := djsbuilder.ListProject(srcDir, outDir)
+			var files []string
+			for _, rel := range append(sources, assets...) {
+				files = append(files, filepath.Join(srcDir, rel))
+			}
+			return files
+		},
+	}
+	w.Snapshot()
+	in := watchInterrupts()
+	defer in.close()
+	for {
+		changed := w.Wait(in.stop)
+		if changed == nil {
+			return signalExitCode(in.signal)
+		}
+		var rebuild []string
+		for _, path := range changed {
+			rel, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				rebuild = append(rebuild, rel)
+				continue
+			}
+			outPath := filepath.Join(outDir, djsbuilder.OutputPath(rel, opts.Module))
+			os.Remove(outPath)
+			os.Remove(outPath + ".map")
+		}
+		if !jsonOutput {
+			fmt.Fprintf(os.Stderr, "[djs] %s changed\n", strings.Join(relativeNames(changed), ", "))
+		}
+		if !reportBuild(djsbuilder.BuildFiles(srcDir, outDir, rebuild, opts), jsonOutput) {
+			return 1
+		}
+	}
+}
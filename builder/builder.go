@@ -6,12 +6,79 @@ import (
 	"github.com/xjslang/xjs/parser"
 )
 
+// Output formats for `import` and `export` declarations.
+const (
+	ModuleCommonJS = "cjs"
+	ModuleESM      = "esm"
+)
+
+// Options configures the DJS parser.
+type Options struct {
+	// Downlevel emits explicit null checks instead of the `?.`, `??` and
+	// `??=` operators, for runtimes without native support.
+	Downlevel bool
+	// PreserveComments keeps license headers and JSDoc blocks in the output,
+	// attached to the declaration that follows them.
+	PreserveComments bool
+	// Module is the output format of `import` and `export` declarations,
+	// ModuleCommonJS (the default) or ModuleESM.
+	Module string
+	// StripAsserts removes `assert` statements from the output, for release
+	// builds.
+	StripAsserts bool
+	// RequireImports emits dynamic `import()` as a promise of `require()`,
+	// including in the `sh` tag, for runtimes that can't parse `import()`,
+	// such as the embedded runtime. It only applies to ModuleCommonJS.
+	RequireImports bool
+}
+
 func New(lb *lexer.Builder) *parser.Builder {
+	return NewWithOptions(lb, Options{})
+}
+
+func NewWithOptions(lb *lexer.Builder, opts Options) *parser.Builder {
+	operators := plugins.OperatorsPlugin
+	if opts.Downlevel {
+		operators = plugins.DownlevelOperatorsPlugin
+	}
+	modules := plugins.CommonJSModulesPlugin
+	template := plugins.TemplatePlugin
+	if opts.Module == ModuleESM {
+		modules = plugins.ModulesPlugin
+	} else if opts.RequireImports {
+		modules = plugins.RequireModulesPlugin
+		template = plugins.RequireTemplatePlugin
+	}
+	comments := plugins.CommentsPlugin
+	if opts.PreserveComments {
+		comments = plugins.PreserveCommentsPlugin
+	}
+	asserts := plugins.AssertPlugin
+	if opts.StripAsserts {
+		asserts = plugins.StripAssertsPlugin
+	}
 	return parser.NewBuilder(lb).
 		WithSmartSemicolon(true).
+		// installed first, so it parses the whole program as a module body
+		Install(modules).
+		Install(plugins.ShebangPlugin).
 		Install(plugins.DeferPlugin).
+		Install(plugins.GeneratorPlugin).
 		Install(plugins.OrPlugin).
 		Install(plugins.StrictEqualityPlugin).
 		Install(plugins.NewPlugin).
-		Install(plugins.ThrowPlugin)
+		Install(plugins.ThrowPlugin).
+		Install(asserts).
+		Install(plugins.TryPlugin).
+		Install(plugins.MatchPlugin).
+		Install(template).
+		Install(plugins.CompatPlugin).
+		Install(plugins.RegexPlugin).
+		Install(plugins.SpreadPlugin).
+		// installed after the plugins above, so optional chains and conditionals
+		// are complete before those plugins inspect the parsed expression
+		Install(operators).
+		// installed last, so its token interceptor is the outermost one and
+		// the token that follows a skipped comment is intercepted only once
+		Install(comments)
 }
@@ -0,0 +1,257 @@
+package builder
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/sourcemap"
+)
+
+// ErrorCodeIO is the code of a FileError caused by reading or writing a file,
+// rather than by a syntax error.
+const ErrorCodeIO = "IO_ERROR"
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	Options
+	// SourceMap writes a source map next to each output file (`<file>.map`).
+	SourceMap bool
+	// InlineSources includes the DJS source in each source map.
+	InlineSources bool
+	// Jobs is the number of files transpiled in parallel. Zero means one per
+	// CPU.
+	Jobs int
+}
+
+// FileError is an error in one file of a build.
+type FileError struct {
+	File string `json:"file"`
+	parser.ParserError
+}
+
+// BuildResult summarizes a build.
+type BuildResult struct {
+	Files  int         // .djs files transpiled
+	Assets int         // other files copied
+	Errors []FileError // errors across all files, sorted by file
+}
+
+// Build transpiles every .djs file under srcDir into the same relative path
+// under outDir, with a .js extension (.mjs for ModuleESM), and copies the
+// other files as they are. A file that fails doesn't stop the build; its
+// errors are reported in the result. The returned error is only set when
+// srcDir can't be read.
+func Build(srcDir, outDir string, opts BuildOptions) (*BuildResult, error) {
+	sources, assets, err := ListProject(srcDir, outDir)
+	if err != nil {
+		return nil, err
+	}
+	return BuildFiles(srcDir, outDir, append(sources, assets...), opts), nil
+}
+
+// ListProject returns the .djs files and the other files under srcDir,
+// relative to it, including symlinks to files. Hidden directories,
+// node_modules and outDir itself are skipped.
+func ListProject(srcDir, outDir string) (sources, assets []string, err error) {
+	srcDir = filepath.Clean(srcDir)
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == srcDir {
+				return nil
+			}
+			if abs, _ := filepath.Abs(path); abs == absOut || strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case filepath.Ext(path) == ".djs":
+			sources = append(sources, rel)
+		case d.Type().IsRegular():
+			assets = append(assets, rel)
+		case d.Type()&fs.ModeSymlink != 0:
+			// a symlinked file is copied as its target. Symlinked directories
+			// are not followed, and a broken link is reported when its copy
+			// fails.
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				assets = append(assets, rel)
+			}
+		}
+		return nil
+	})
+	return sources, assets, err
+}
+
+// OutputPath returns the path under the output directory of a file built
+// from rel, a path relative to the source directory.
+func OutputPath(rel string, module string) string {
+	if filepath.Ext(rel) != ".djs" {
+		return rel
+	}
+	if module == ModuleESM {
+		return strings.TrimSuffix(rel, ".djs") + ".mjs"
+	}
+	return strings.TrimSuffix(rel, ".djs") + ".js"
+}
+
+// BuildFiles builds the given files, relative to srcDir, like Build. Watch
+// mode uses it to build only the files that changed.
+func BuildFiles(srcDir, outDir string, files []string, opts BuildOptions) *BuildResult {
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	queue := make(chan string)
+	var mu sync.Mutex
+	result := &BuildResult{}
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range queue {
+				source := filepath.Ext(rel) == ".djs"
+				srcPath := filepath.Join(srcDir, rel)
+				outPath := filepath.Join(outDir, OutputPath(rel, opts.Module))
+				var errs []FileError
+				if source {
+					errs = buildFile(srcPath, outPath, opts)
+				} else {
+					errs = copyAsset(srcPath, outPath)
+				}
+				mu.Lock()
+				result.Errors = append(result.Errors, errs...)
+				if len(errs) == 0 && source {
+					result.Files++
+				} else if len(errs) == 0 {
+					result.Assets++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, rel := range files {
+		queue <- rel
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].File < result.Errors[j].File
+	})
+	return result
+}
+
+// buildFile transpiles a single file, writing its source map next to it.
+func buildFile(srcPath, outPath string, opts BuildOptions) []FileError {
+	code, err := os.ReadFile(srcPath)
+	if err != nil {
+		return []FileError{ioError(srcPath, err)}
+	}
+
+	p := NewWithOptions(lexer.NewBuilder(), opts.Options).Build(string(code))
+	program, err := p.ParseProgram()
+	if err != nil {
+		var errs []FileError
+		for _, perr := range p.Errors() {
+			errs = append(errs, FileError{File: srcPath, ParserError: perr})
+		}
+		return errs
+	}
+
+	c := compiler.New()
+	if opts.SourceMap {
+		c = c.WithSourceMap()
+	}
+	result := c.Compile(program)
+	js := result.Code
+	if !strings.HasSuffix(js, "\n") {
+		js += "\n"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return []FileError{ioError(outPath, err)}
+	}
+	if opts.SourceMap {
+		sm := result.SourceMap
+		if sm == nil {
+			sm = &sourcemap.SourceMap{Version: 3}
+		}
+		// a relative source keeps the output tree relocatable
+		source, err := filepath.Rel(filepath.Dir(outPath), srcPath)
+		if err != nil {
+			source = srcPath
+		}
+		sm.Sources = []string{filepath.ToSlash(source)}
+		if opts.InlineSources {
+			sm.SourcesContent = []string{string(code)}
+		}
+		sm.File = filepath.Base(outPath)
+		smJSON, err := json.Marshal(sm)
+		if err != nil {
+			return []FileError{ioError(outPath, err)}
+		}
+		if err := os.WriteFile(outPath+".map", smJSON, 0o644); err != nil {
+			return []FileError{ioError(outPath+".map", err)}
+		}
+		js += "//# sourceMappingURL=" + filepath.Base(outPath) + ".map\n"
+	}
+	if err := os.WriteFile(outPath, []byte(js), 0o644); err != nil {
+		return []FileError{ioError(outPath, err)}
+	}
+	return nil
+}
+
+// copyAsset copies a file that isn't DJS source, keeping its permissions.
+func copyAsset(srcPath, outPath string) []FileError {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return []FileError{ioError(srcPath, err)}
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return []FileError{ioError(srcPath, err)}
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return []FileError{ioError(outPath, err)}
+	}
+	out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return []FileError{ioError(outPath, err)}
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return []FileError{ioError(outPath, err)}
+	}
+	if err := out.Close(); err != nil {
+		return []FileError{ioError(outPath, err)}
+	}
+	return nil
+}
+
+func ioError(path string, err error) FileError {
+	return FileError{File: path, ParserError: parser.ParserError{Message: err.Error(), Code: ErrorCodeIO}}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/plugins"
+)
+
+// The cache directory holds the compiled code of the DJS files djs runs, in
+// run/, and the Node.js loader scripts, in loader/. A compiled file embeds
+// its source map, and is stored with the list of the .djs files it imports
+// and of the features it needs from Node.js (a .deps file), so running an
+// unchanged file doesn't parse it again.
+
+// cacheDir returns the directory of the files djs writes to run programs,
+// in the user cache directory, or in the temporary directory if there is
+// none.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "djs")
+}
+
+// cacheVersion identifies the version of djs and its compiler, since another
+// version may compile a file differently. Development builds may have no
+// version, so they are also identified by the time of their executable.
+var cacheVersion = sync.OnceValue(func() string {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/xjslang/xjs" {
+				version += " xjs@" + dep.Version
+			}
+		}
+	}
+	if strings.HasPrefix(version, "(devel)") || strings.Contains(version, "+dirty") {
+		if info, err := os.Stat(djsExecutable()); err == nil {
+			version += " " + info.ModTime().UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return version
+})
+
+// optionsKey is the version and options part of the hash of compiled files.
+func optionsKey(opts djsbuilder.Options) string {
+	return cacheVersion() + "\x00" + fmt.Sprintf("%+v", opts)
+}
+
+// compiledPath returns the path of the compiled code of a DJS file in the
+// cache directory. Runs of the same version of a file share it, and versions
+// of a file don't overwrite each other.
+func compiledPath(absInputPath string, source []byte, opts djsbuilder.Options) string {
+	// Node.js loads files from their real paths
+	if real, err := filepath.EvalSymlinks(absInputPath); err == nil {
+		absInputPath = real
+	}
+	h := sha256.New()
+	h.Write([]byte(absInputPath + "\x00" + optionsKey(opts) + "\x00"))
+	h.Write(source)
+	return filepath.Join(cacheDir(), "run", hex.EncodeToString(h.Sum(nil))[:16]+executionExt(opts.Module))
+}
+
+// writeCompiledJS writes the compiled code of a DJS file to the cache
+// directory, and returns its path.
+func writeCompiledJS(absInputPath string, source []byte, opts djsbuilder.Options, js string) (string, error) {
+	path := compiledPath(absInputPath, source, opts)
+	if err := writeFileAtomic(path, js); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// depsPath returns the path of the list of imports and features of a
+// compiled file.
+func depsPath(compiledPath string) string {
+	return strings.TrimSuffix(compiledPath, filepath.Ext(compiledPath)) + ".deps"
+}
+
+// cachedModule is what the cache keeps about a compiled file besides its
+// code, in its .deps file.
+type cachedModule struct {
+	imports  []string          // the imported .djs files, as written in the source
+	features []plugins.Feature // the features that need a recent Node.js
+}
+
+// readCachedModule returns the imports and features of a compiled file, and
+// reports whether the file and its .deps file are in the cache. Files
+// compiled by the loader have no .deps file.
+func readCachedModule(compiledPath string) (cachedModule, bool) {
+	var m cachedModule
+	if _, err := os.Stat(compiledPath); err != nil {
+		return m, false
+	}
+	data, err := os.ReadFile(depsPath(compiledPath))
+	if err != nil {
+		return m, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if imp, ok := strings.CutPrefix(line, "import "); ok {
+			m.imports = append(m.imports, imp)
+		} else if feature, ok := strings.CutPrefix(line, "feature "); ok {
+			m.features = append(m.features, plugins.Feature(feature))
+		}
+	}
+	return m, true
+}
+
+// writeCachedModule writes the .deps file of a compiled file.
+func writeCachedModule(compiledPath string, m cachedModule) error {
+	var content strings.Builder
+	for _, imp := range m.imports {
+		content.WriteString("import " + imp + "\n")
+	}
+	for _, feature := range m.features {
+		content.WriteString("feature " + string(feature) + "\n")
+	}
+	return writeFileAtomic(depsPath(compiledPath), content.String())
+}
+
+// writeFileAtomic writes a file through a temporary file, so concurrent runs
+// never read a partial file.
+func writeFileAtomic(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runCache implements `djs cache clean` and `djs cache stats`.
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: djs cache clean|stats")
+		fmt.Fprintln(os.Stderr, "\nThe cache holds the compiled code of the programs djs runs, so unchanged")
+		fmt.Fprintln(os.Stderr, "files aren't compiled again.")
+		fmt.Fprintln(os.Stderr, "\nCommands:")
+		fmt.Fprintln(os.Stderr, "  clean    Remove the cache directory")
+		fmt.Fprintln(os.Stderr, "  stats    Show the location and size of the cache")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	dir := cacheDir()
+	stats, err := scanCache(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the cache: %v\n", err)
+		return 1
+	}
+	switch fs.Arg(0) {
+	case "clean":
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing the cache: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Removed %d files (%s) from %s\n", stats.files, formatSize(stats.size), dir)
+	case "stats":
+		fmt.Printf("Cache directory: %s\n", dir)
+		fmt.Printf("Compiled files:  %d (%s)\n", stats.compiled, formatSize(stats.compiledSize))
+		fmt.Printf("Loader versions: %d\n", stats.loaders)
+		fmt.Printf("Total:           %d files (%s)\n", stats.files, formatSize(stats.size))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown cache command %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+type cacheStats struct {
+	files        int   // all the files
+	size         int64 // size of all the files
+	compiled     int   // compiled .djs files
+	compiledSize int64 // size of the compiled files and their lists of imports
+	loaders      int   // versions of the loader scripts
+}
+
+// scanCache returns the statistics of a cache directory, which may not
+// exist yet.
+func scanCache(dir string) (cacheStats, error) {
+	var stats cacheStats
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if filepath.Dir(path) == filepath.Join(dir, "loader") {
+				stats.loaders++
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.files++
+		stats.size += info.Size()
+		if filepath.Dir(path) == filepath.Join(dir, "run") {
+			if ext := filepath.Ext(path); ext == ".js" || ext == ".mjs" {
+				stats.compiled++
+			}
+			stats.compiledSize += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// formatSize formats a number of bytes for people.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
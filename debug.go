@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// Programs run from the paths of their .djs files, with inline source maps
+// that include the DJS source, so debuggers attached with --inspect bind
+// breakpoints set in the .djs files, and keep them across restarts.
+
+// inspectFlag is --inspect or --inspect-brk, which take an optional
+// [host:]port like in Node.js.
+type inspectFlag struct {
+	name    string
+	enabled bool
+	address string
+}
+
+func (f *inspectFlag) String() string {
+	return f.address
+}
+
+func (f *inspectFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.enabled = true
+	case "false":
+		f.enabled = false
+	default:
+		f.enabled, f.address = true, value
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *inspectFlag) IsBoolFlag() bool {
+	return true
+}
+
+// nodeFlag returns the Node.js flag, or "" if the flag isn't given.
+func (f *inspectFlag) nodeFlag() string {
+	if !f.enabled {
+		return ""
+	}
+	if f.address != "" {
+		return "--" + f.name + "=" + f.address
+	}
+	return "--" + f.name
+}
+
+// launchFile is a VS Code launch.json file.
+type launchFile struct {
+	Version        string         `json:"version"`
+	Configurations []launchConfig `json:"configurations"`
+}
+
+// launchConfig is a configuration of a launch.json file.
+type launchConfig struct {
+	Type              string   `json:"type"`
+	Request           string   `json:"request"`
+	Name              string   `json:"name"`
+	RuntimeExecutable string   `json:"runtimeExecutable,omitempty"`
+	RuntimeArgs       []string `json:"runtimeArgs,omitempty"`
+	Program           string   `json:"program,omitempty"`
+	Port              int      `json:"port,omitempty"`
+	Restart           bool     `json:"restart,omitempty"`
+	Console           string   `json:"console,omitempty"`
+	SourceMaps        bool     `json:"sourceMaps"`
+	SkipFiles         []string `json:"skipFiles"`
+}
+
+// runLaunchJSON implements `djs launch-json [file.djs]`, which prints a VS
+// Code launch.json file that debugs a DJS program.
+func runLaunchJSON(args []string) int {
+	fs := flag.NewFlagSet("launch-json", flag.ContinueOnError)
+	var moduleFormat string
+	var port int
+	fs.StringVar(&moduleFormat, "module", djsbuilder.ModuleCommonJS, "Output format of import/export: cjs or esm")
+	fs.IntVar(&port, "port", 9229, "Port of the attach configuration, for djs --inspect")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: djs launch-json [options] [file.djs] > .vscode/launch.json")
+		fmt.Fprintln(os.Stderr, "\nPrints a VS Code launch.json file with a configuration that runs the file")
+		fmt.Fprintln(os.Stderr, "in the debugger (the file open in the editor if none is given), and one that")
+		fmt.Fprintln(os.Stderr, "attaches to a program run with djs --inspect.")
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		fs.PrintDefaults()
+	}
+	// flags may come before or after the file
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return 2
+	}
+	if moduleFormat != djsbuilder.ModuleCommonJS && moduleFormat != djsbuilder.ModuleESM {
+		fmt.Fprintf(os.Stderr, "Error: --module must be %q or %q\n", djsbuilder.ModuleCommonJS, djsbuilder.ModuleESM)
+		return 2
+	}
+
+	program, name := "${file}", "current file"
+	if len(positional) == 1 {
+		rel := positional[0]
+		if abs, err := filepath.Abs(rel); err == nil {
+			if wd, err := os.Getwd(); err == nil {
+				if r, err := filepath.Rel(wd, abs); err == nil {
+					rel = r
+				}
+			}
+		}
+		program, name = "${workspaceFolder}/"+filepath.ToSlash(rel), filepath.Base(rel)
+	}
+	var runtimeArgs []string
+	if moduleFormat == djsbuilder.ModuleESM {
+		runtimeArgs = []string{"--module", "esm"}
+	}
+
+	// The debugger attaches to the Node.js process that djs starts, which
+	// inherits its environment
+	skipFiles := []string{"<node_internals>/**"}
+	launch := launchFile{
+		Version: "0.2.0",
+		Configurations: []launchConfig{
+			{
+				Type:              "node",
+				Request:           "launch",
+				Name:              "Debug " + name + " (djs)",
+				RuntimeExecutable: "djs",
+				RuntimeArgs:       runtimeArgs,
+				Program:           program,
+				Console:           "integratedTerminal",
+				SourceMaps:        true,
+				SkipFiles:         skipFiles,
+			},
+			{
+				Type:       "node",
+				Request:    "attach",
+				Name:       "Attach to djs --inspect",
+				Port:       port,
+				Restart:    true,
+				SourceMaps: true,
+				SkipFiles:  skipFiles,
+			},
+		},
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(launch); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing launch.json: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// newChildProcess returns the child_process module, with execSync,
+// execFileSync, spawnSync, exec and execFile. Output is returned as strings.
+func (r *Runtime) newChildProcess() *goja.Object {
+	module := r.vm.NewObject()
+	_ = module.Set("execSync", func(call goja.FunctionCall) goja.Value {
+		command := call.Argument(0).String()
+		return r.execSync(shellCommand(command), command, call.Argument(1))
+	})
+	_ = module.Set("execFileSync", func(call goja.FunctionCall) goja.Value {
+		file, args, options := r.fileArgs(call)
+		return r.execSync(exec.Command(file, args...), strings.Join(append([]string{file}, args...), " "), options)
+	})
+	_ = module.Set("spawnSync", func(call goja.FunctionCall) goja.Value {
+		file, args, options := r.fileArgs(call)
+		return r.spawnSync(file, args, options)
+	})
+	_ = module.Set("exec", func(call goja.FunctionCall) goja.Value {
+		command := call.Argument(0).String()
+		options, cb := r.optionsAndCallback(call.Arguments[min(1, len(call.Arguments)):])
+		r.execAsync(shellCommand(command), command, options, cb)
+		return goja.Undefined()
+	})
+	_ = module.Set("execFile", func(call goja.FunctionCall) goja.Value {
+		file := call.Argument(0).String()
+		rest := call.Arguments[min(1, len(call.Arguments)):]
+		var args []string
+		if len(rest) > 0 {
+			if list, ok := rest[0].Export().([]any); ok {
+				args = stringList(list)
+				rest = rest[1:]
+			}
+		}
+		options, cb := r.optionsAndCallback(rest)
+		r.execAsync(exec.Command(file, args...), strings.Join(append([]string{file}, args...), " "), options, cb)
+		return goja.Undefined()
+	})
+	return module
+}
+
+// shellCommand runs a command in the shell, like Node's exec.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd.exe", "/d", "/s", "/c", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+// fileArgs reads the (file, [args], [options]) arguments of execFileSync and
+// spawnSync.
+func (r *Runtime) fileArgs(call goja.FunctionCall) (string, []string, goja.Value) {
+	file := call.Argument(0).String()
+	options := call.Argument(1)
+	if list, ok := options.Export().([]any); ok {
+		return file, stringList(list), call.Argument(2)
+	}
+	return file, nil, options
+}
+
+// optionsAndCallback reads the ([options], callback) arguments of exec and
+// execFile.
+func (r *Runtime) optionsAndCallback(args []goja.Value) (goja.Value, goja.Callable) {
+	options := goja.Undefined()
+	for _, arg := range args {
+		if cb, ok := goja.AssertFunction(arg); ok {
+			return options, cb
+		}
+		options = arg
+	}
+	return options, nil
+}
+
+// configure applies the cwd, env, input and stdio options to cmd. Unless
+// stdio is "inherit", stdout and stderr are captured, and stderr is also
+// shown if showStderr is set.
+func (r *Runtime) configure(cmd *exec.Cmd, options goja.Value, showStderr bool) (stdout, stderr *bytes.Buffer) {
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Env = r.environ(nil)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if showStderr {
+		cmd.Stderr = io.MultiWriter(stderr, r.opts.Stderr)
+	}
+	obj, ok := options.(*goja.Object)
+	if !ok {
+		return stdout, stderr
+	}
+	if cwd := obj.Get("cwd"); cwd != nil && !goja.IsUndefined(cwd) {
+		cmd.Dir = cwd.String()
+	}
+	if env, ok := obj.Get("env").(*goja.Object); ok {
+		cmd.Env = r.environ(env)
+	}
+	if input := obj.Get("input"); input != nil && !goja.IsUndefined(input) {
+		cmd.Stdin = strings.NewReader(input.String())
+	}
+	if stdio := obj.Get("stdio"); stdio != nil && stdio.String() == "inherit" {
+		cmd.Stdin = r.opts.Stdin
+		cmd.Stdout = r.opts.Stdout
+		cmd.Stderr = r.opts.Stderr
+	}
+	return stdout, stderr
+}
+
+// environ returns the environment of a child process: env, or process.env.
+func (r *Runtime) environ(env *goja.Object) []string {
+	if env == nil {
+		env = r.process.Get("env").ToObject(r.vm)
+	}
+	var environ []string
+	for _, key := range env.Keys() {
+		if value := env.Get(key); value != nil && !goja.IsUndefined(value) {
+			environ = append(environ, key+"="+value.String())
+		}
+	}
+	return environ
+}
+
+// exitStatus returns the exit code of a command, or -1 if it didn't run.
+func exitStatus(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// commandError returns the error of a failed command, like Node.js: code is
+// the exit code for exec, status for execSync.
+func (r *Runtime) commandError(err error, command string, stdout, stderr *bytes.Buffer) *goja.Object {
+	message := "Command failed: " + command
+	if stderr.Len() > 0 {
+		message += "\n" + stderr.String()
+	}
+	status := exitStatus(err)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		message = "spawn " + command + " " + err.Error()
+	}
+	return r.newError("Error", message, map[string]any{
+		"code":   status,
+		"status": status,
+		"cmd":    command,
+		"stdout": stdout.String(),
+		"stderr": stderr.String(),
+	})
+}
+
+func (r *Runtime) execSync(cmd *exec.Cmd, command string, options goja.Value) goja.Value {
+	stdout, stderr := r.configure(cmd, options, true)
+	if err := cmd.Run(); err != nil {
+		panic(r.commandError(err, command, stdout, stderr))
+	}
+	return r.vm.ToValue(stdout.String())
+}
+
+// spawnSync never throws: errors are reported in the result.
+func (r *Runtime) spawnSync(file string, args []string, options goja.Value) goja.Value {
+	cmd := exec.Command(file, args...)
+	if obj, ok := options.(*goja.Object); ok {
+		if shell := obj.Get("shell"); shell != nil && shell.ToBoolean() {
+			cmd = shellCommand(strings.Join(append([]string{file}, args...), " "))
+		}
+	}
+	stdout, stderr := r.configure(cmd, options, true)
+	err := cmd.Run()
+	result := r.vm.NewObject()
+	_ = result.Set("stdout", stdout.String())
+	_ = result.Set("stderr", stderr.String())
+	_ = result.Set("signal", goja.Null())
+	status := exitStatus(err)
+	if status < 0 {
+		_ = result.Set("status", goja.Null())
+		_ = result.Set("error", r.commandError(err, file, stdout, stderr))
+	} else {
+		_ = result.Set("status", status)
+	}
+	if cmd.Process != nil {
+		_ = result.Set("pid", cmd.Process.Pid)
+	}
+	return result
+}
+
+// execAsync runs a command on another goroutine, and calls cb with
+// (error, stdout, stderr) on the event loop.
+func (r *Runtime) execAsync(cmd *exec.Cmd, command string, options goja.Value, cb goja.Callable) {
+	stdout, stderr := r.configure(cmd, options, false)
+	r.async(func() func() {
+		err := cmd.Run()
+		return func() {
+			if cb == nil {
+				return
+			}
+			errValue := goja.Null()
+			if err != nil {
+				errValue = r.commandError(err, command, stdout, stderr)
+			}
+			r.call(cb, errValue, r.vm.ToValue(stdout.String()), r.vm.ToValue(stderr.String()))
+		}
+	})
+}
+
+func stringList(list []any) []string {
+	strs := make([]string, len(list))
+	for i, item := range list {
+		strs[i] = fmt.Sprint(item)
+	}
+	return strs
+}
@@ -0,0 +1,279 @@
+package embedded
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// inspectDepth is how deep nested objects are shown, like in Node.js.
+const inspectDepth = 2
+
+// breakLength is the length above which objects are shown on several lines.
+const breakLength = 72
+
+func (r *Runtime) newConsole() *goja.Object {
+	print := func(w io.Writer) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			fmt.Fprintln(w, Format(r.vm, call.Arguments))
+			return goja.Undefined()
+		}
+	}
+	console := r.vm.NewObject()
+	_ = console.Set("log", print(r.opts.Stdout))
+	_ = console.Set("info", print(r.opts.Stdout))
+	_ = console.Set("debug", print(r.opts.Stdout))
+	_ = console.Set("warn", print(r.opts.Stderr))
+	_ = console.Set("error", print(r.opts.Stderr))
+	_ = console.Set("dir", func(call goja.FunctionCall) goja.Value {
+		fmt.Fprintln(r.opts.Stdout, Inspect(r.vm, call.Argument(0)))
+		return goja.Undefined()
+	})
+	return console
+}
+
+// Format formats console arguments like Node's util.format: a first string
+// argument may contain %s, %d, %i, %f, %j, %o, %O and %c placeholders, and
+// the other arguments are appended, strings as they are and other values
+// formatted by Inspect.
+func Format(vm *goja.Runtime, args []goja.Value) string {
+	var parts []string
+	if len(args) > 0 {
+		if format, ok := args[0].Export().(string); ok && strings.Contains(format, "%") {
+			var sb strings.Builder
+			next := 1
+			for i := 0; i < len(format); i++ {
+				if format[i] != '%' || i+1 == len(format) {
+					sb.WriteByte(format[i])
+					continue
+				}
+				verb := format[i+1]
+				if verb == '%' {
+					sb.WriteByte('%')
+					i++
+					continue
+				}
+				if !strings.ContainsRune("sdifjoOc", rune(verb)) || next >= len(args) {
+					sb.WriteByte('%')
+					continue
+				}
+				arg := args[next]
+				next++
+				i++
+				switch verb {
+				case 's':
+					if _, ok := arg.(*goja.Object); ok {
+						sb.WriteString(inspect(vm, arg, 1, nil))
+					} else {
+						sb.WriteString(formatArg(vm, arg))
+					}
+				case 'd', 'i':
+					n := arg.ToFloat()
+					if verb == 'i' {
+						n = float64(int64(n))
+					}
+					sb.WriteString(vm.ToValue(n).String())
+				case 'f':
+					sb.WriteString(vm.ToValue(arg.ToFloat()).String())
+				case 'j':
+					stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+					if str, err := stringify(goja.Undefined(), arg); err == nil {
+						sb.WriteString(str.String())
+					} else {
+						sb.WriteString("[Circular]")
+					}
+				case 'o', 'O':
+					sb.WriteString(Inspect(vm, arg))
+				}
+			}
+			parts = append(parts, sb.String())
+			args = args[next:]
+		}
+	}
+	for _, arg := range args {
+		parts = append(parts, formatArg(vm, arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatArg(vm *goja.Runtime, arg goja.Value) string {
+	if str, ok := arg.Export().(string); ok {
+		return str
+	}
+	return Inspect(vm, arg)
+}
+
+// Inspect formats a value like Node's util.inspect: strings are quoted, and
+// objects and arrays show their properties down to a depth of 2.
+func Inspect(vm *goja.Runtime, value goja.Value) string {
+	return inspect(vm, value, 0, nil)
+}
+
+func inspect(vm *goja.Runtime, value goja.Value, depth int, seen []*goja.Object) string {
+	if value == nil || goja.IsUndefined(value) {
+		return "undefined"
+	}
+	if goja.IsNull(value) {
+		return "null"
+	}
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		switch v := value.Export().(type) {
+		case string:
+			return quote(v)
+		case *big.Int:
+			return v.String() + "n"
+		}
+		return value.String()
+	}
+
+	for _, other := range seen {
+		if other == obj {
+			return "[Circular]"
+		}
+	}
+	seen = append(seen, obj)
+
+	if _, ok := goja.AssertFunction(obj); ok {
+		if name := obj.Get("name"); name != nil && name.String() != "" {
+			return "[Function: " + name.String() + "]"
+		}
+		return "[Function (anonymous)]"
+	}
+	switch className(vm, obj) {
+	case "Error":
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			return nodeStack(stack.String())
+		}
+		return obj.String()
+	case "RegExp":
+		return obj.String()
+	case "Date":
+		if toISO, ok := goja.AssertFunction(obj.Get("toISOString")); ok {
+			if iso, err := toISO(obj); err == nil {
+				return iso.String()
+			}
+		}
+		return obj.String()
+	case "Promise":
+		promise, _ := obj.Export().(*goja.Promise)
+		switch {
+		case promise == nil:
+		case promise.State() == goja.PromiseStatePending:
+			return "Promise { <pending> }"
+		case promise.State() == goja.PromiseStateRejected:
+			return "Promise { <rejected> " + inspect(vm, promise.Result(), depth+1, seen) + " }"
+		default:
+			return "Promise { " + inspect(vm, promise.Result(), depth+1, seen) + " }"
+		}
+	case "Array":
+		if depth > inspectDepth {
+			return "[Array]"
+		}
+		length := int(obj.Get("length").ToInteger())
+		items := make([]string, length)
+		for i := range items {
+			items[i] = inspect(vm, obj.Get(strconv.Itoa(i)), depth+1, seen)
+		}
+		return group("", "[", "]", items)
+	case "Map", "Set":
+		from, _ := goja.AssertFunction(vm.Get("Array").ToObject(vm).Get("from"))
+		entries, err := from(goja.Undefined(), obj)
+		if err != nil {
+			break
+		}
+		list := entries.ToObject(vm)
+		length := int(list.Get("length").ToInteger())
+		class := className(vm, obj)
+		prefix := class + "(" + strconv.Itoa(length) + ") "
+		if depth > inspectDepth {
+			return "[" + class + "]"
+		}
+		items := make([]string, length)
+		for i := range items {
+			entry := list.Get(strconv.Itoa(i))
+			if class == "Map" {
+				pair := entry.ToObject(vm)
+				items[i] = inspect(vm, pair.Get("0"), depth+1, seen) + " => " + inspect(vm, pair.Get("1"), depth+1, seen)
+			} else {
+				items[i] = inspect(vm, entry, depth+1, seen)
+			}
+		}
+		return group(prefix, "{", "}", items)
+	}
+
+	prefix := ""
+	if ctor, ok := obj.Get("constructor").(*goja.Object); ok {
+		if name := ctor.Get("name"); name != nil && name.String() != "" && name.String() != "Object" {
+			prefix = name.String() + " "
+		}
+	}
+	if depth > inspectDepth {
+		return "[" + strings.TrimSpace(prefix+"Object") + "]"
+	}
+	keys := obj.Keys()
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		items[i] = propertyName(key) + ": " + inspect(vm, obj.Get(key), depth+1, seen)
+	}
+	return group(prefix, "{", "}", items)
+}
+
+// className returns the class of built-in objects. goja reports Map, Set
+// and Promise objects as "Object".
+func className(vm *goja.Runtime, obj *goja.Object) string {
+	if _, ok := obj.Export().(*goja.Promise); ok {
+		return "Promise"
+	}
+	for _, name := range []string{"Map", "Set"} {
+		if ctor, ok := vm.Get(name).(*goja.Object); ok && vm.InstanceOf(obj, ctor) {
+			return name
+		}
+	}
+	return obj.ClassName()
+}
+
+// group joins items in brackets, on one line when they are short enough.
+func group(prefix, open, close string, items []string) string {
+	if len(items) == 0 {
+		return prefix + open + close
+	}
+	length := len(prefix)
+	multiline := false
+	for _, item := range items {
+		length += len(item) + 2
+		multiline = multiline || strings.Contains(item, "\n")
+	}
+	if !multiline && length <= breakLength {
+		return prefix + open + " " + strings.Join(items, ", ") + " " + close
+	}
+	// nested groups are indented by their parent
+	for i, item := range items {
+		items[i] = "  " + strings.ReplaceAll(item, "\n", "\n  ")
+	}
+	return prefix + open + "\n" + strings.Join(items, ",\n") + "\n" + close
+}
+
+// propertyName quotes keys that aren't valid identifiers.
+func propertyName(key string) string {
+	for i, ch := range key {
+		if !(ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || i > 0 && ch >= '0' && ch <= '9') {
+			return quote(key)
+		}
+	}
+	if key == "" {
+		return "''"
+	}
+	return key
+}
+
+// quote quotes a string with single quotes, like Node.js.
+func quote(s string) string {
+	quoted := strconv.Quote(s)
+	quoted = strings.ReplaceAll(quoted[1:len(quoted)-1], `\"`, `"`)
+	return "'" + strings.ReplaceAll(quoted, "'", `\'`) + "'"
+}
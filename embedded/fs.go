@@ -0,0 +1,367 @@
+package embedded
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"syscall"
+
+	"github.com/dop251/goja"
+)
+
+// fsOp is a file system operation. It returns a JavaScript error instead of
+// throwing it, so the same operation backs the synchronous, callback and
+// promise forms of a function.
+type fsOp func(args []goja.Value) (goja.Value, *goja.Object)
+
+// newFS returns the fs module. File contents are read and written as strings,
+// since Buffer isn't available.
+func (r *Runtime) newFS() *goja.Object {
+	ops := map[string]fsOp{
+		"access":     r.fsAccess,
+		"appendFile": r.fsWriteFile(os.O_APPEND),
+		"copyFile":   r.fsCopyFile,
+		"lstat":      r.fsStat(os.Lstat, "lstat"),
+		"mkdir":      r.fsMkdir,
+		"readFile":   r.fsReadFile,
+		"readdir":    r.fsReaddir,
+		"rename":     r.fsRename,
+		"rm":         r.fsRm,
+		"rmdir":      r.fsRmdir,
+		"stat":       r.fsStat(os.Stat, "stat"),
+		"unlink":     r.fsUnlink,
+		"writeFile":  r.fsWriteFile(os.O_TRUNC),
+	}
+	module := r.vm.NewObject()
+	promises := r.vm.NewObject()
+	for name, op := range ops {
+		_ = module.Set(name+"Sync", r.syncOp(op))
+		_ = module.Set(name, r.callbackOp(op))
+		_ = promises.Set(name, r.promiseOp(op))
+	}
+	_ = module.Set("existsSync", func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	_ = module.Set("promises", promises)
+	return module
+}
+
+func (r *Runtime) syncOp(op fsOp) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		result, err := op(call.Arguments)
+		if err != nil {
+			panic(err)
+		}
+		return result
+	}
+}
+
+// callbackOp calls the callback, which is the last argument, on the next turn
+// of the event loop.
+func (r *Runtime) callbackOp(op fsOp) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		args := call.Arguments
+		var cb goja.Callable
+		if len(args) > 0 {
+			cb, _ = goja.AssertFunction(args[len(args)-1])
+		}
+		if cb == nil {
+			panic(r.vm.NewTypeError("the callback argument must be a function"))
+		}
+		result, err := op(args[:len(args)-1])
+		r.enqueue(func() {
+			if err != nil {
+				r.call(cb, err)
+			} else {
+				r.call(cb, goja.Null(), result)
+			}
+		})
+		return goja.Undefined()
+	}
+}
+
+func (r *Runtime) promiseOp(op fsOp) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := r.vm.NewPromise()
+		if result, err := op(call.Arguments); err != nil {
+			_ = reject(err)
+		} else {
+			_ = resolve(result)
+		}
+		return r.vm.ToValue(promise)
+	}
+}
+
+func (r *Runtime) fsReadFile(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, r.fsError(readErr, "open", path)
+	}
+	return r.vm.ToValue(string(data)), nil
+}
+
+// fsWriteFile returns writeFile or appendFile, depending on flag.
+func (r *Runtime) fsWriteFile(flag int) fsOp {
+	return func(args []goja.Value) (goja.Value, *goja.Object) {
+		path, err := r.pathArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		data := ""
+		if len(args) > 1 {
+			data = args[1].String()
+		}
+		f, openErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o666)
+		if openErr != nil {
+			return nil, r.fsError(openErr, "open", path)
+		}
+		_, writeErr := io.WriteString(f, data)
+		if closeErr := f.Close(); writeErr == nil {
+			writeErr = closeErr
+		}
+		if writeErr != nil {
+			return nil, r.fsError(writeErr, "write", path)
+		}
+		return goja.Undefined(), nil
+	}
+}
+
+func (r *Runtime) fsAccess(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		return nil, r.fsError(statErr, "access", path)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsStat(stat func(string) (os.FileInfo, error), sys string) fsOp {
+	return func(args []goja.Value) (goja.Value, *goja.Object) {
+		path, err := r.pathArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		info, statErr := stat(path)
+		if statErr != nil {
+			return nil, r.fsError(statErr, sys, path)
+		}
+		return r.newStats(info), nil
+	}
+}
+
+func (r *Runtime) newStats(info os.FileInfo) *goja.Object {
+	mtime, _ := r.vm.New(r.vm.Get("Date"), r.vm.ToValue(info.ModTime().UnixMilli()))
+	stats := r.vm.NewObject()
+	_ = stats.Set("size", info.Size())
+	_ = stats.Set("mode", uint32(info.Mode().Perm()))
+	_ = stats.Set("mtimeMs", info.ModTime().UnixMilli())
+	_ = stats.Set("mtime", mtime)
+	_ = stats.Set("isFile", func() bool { return info.Mode().IsRegular() })
+	_ = stats.Set("isDirectory", info.IsDir)
+	_ = stats.Set("isSymbolicLink", func() bool { return info.Mode()&fs.ModeSymlink != 0 })
+	return stats
+}
+
+// fsReaddir lists the names in a directory in sorted order, or dirents with
+// the withFileTypes option.
+func (r *Runtime) fsReaddir(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries, readErr := os.ReadDir(path)
+	if readErr != nil {
+		return nil, r.fsError(readErr, "scandir", path)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	if !r.boolOption(args, 1, "withFileTypes") {
+		names := make([]any, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		return r.vm.ToValue(names), nil
+	}
+	dirents := make([]any, len(entries))
+	for i, entry := range entries {
+		dirent := r.vm.NewObject()
+		_ = dirent.Set("name", entry.Name())
+		_ = dirent.Set("isFile", entry.Type().IsRegular)
+		_ = dirent.Set("isDirectory", entry.IsDir)
+		_ = dirent.Set("isSymbolicLink", func() bool { return entry.Type()&fs.ModeSymlink != 0 })
+		dirents[i] = dirent
+	}
+	return r.vm.ToValue(dirents), nil
+}
+
+func (r *Runtime) fsMkdir(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var mkErr error
+	if r.boolOption(args, 1, "recursive") {
+		mkErr = os.MkdirAll(path, 0o777)
+	} else {
+		mkErr = os.Mkdir(path, 0o777)
+	}
+	if mkErr != nil {
+		return nil, r.fsError(mkErr, "mkdir", path)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsRm(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := os.Lstat(path)
+	switch {
+	case statErr != nil:
+		if r.boolOption(args, 1, "force") && errors.Is(statErr, fs.ErrNotExist) {
+			return goja.Undefined(), nil
+		}
+		return nil, r.fsError(statErr, "rm", path)
+	case info.IsDir() && !r.boolOption(args, 1, "recursive"):
+		return nil, r.fsError(syscall.EISDIR, "rm", path)
+	}
+	if rmErr := os.RemoveAll(path); rmErr != nil {
+		return nil, r.fsError(rmErr, "rm", path)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsRmdir(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := os.Stat(path)
+	if statErr == nil && !info.IsDir() {
+		statErr = syscall.ENOTDIR
+	}
+	if statErr != nil {
+		return nil, r.fsError(statErr, "rmdir", path)
+	}
+	if rmErr := os.Remove(path); rmErr != nil {
+		return nil, r.fsError(rmErr, "rmdir", path)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsUnlink(args []goja.Value) (goja.Value, *goja.Object) {
+	path, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := os.Lstat(path)
+	if statErr == nil && info.IsDir() {
+		statErr = syscall.EISDIR
+	}
+	if statErr != nil {
+		return nil, r.fsError(statErr, "unlink", path)
+	}
+	if rmErr := os.Remove(path); rmErr != nil {
+		return nil, r.fsError(rmErr, "unlink", path)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsRename(args []goja.Value) (goja.Value, *goja.Object) {
+	from, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.pathArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if renameErr := os.Rename(from, to); renameErr != nil {
+		return nil, r.fsError(renameErr, "rename", from)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) fsCopyFile(args []goja.Value) (goja.Value, *goja.Object) {
+	from, err := r.pathArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.pathArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	data, readErr := os.ReadFile(from)
+	if readErr != nil {
+		return nil, r.fsError(readErr, "copyfile", from)
+	}
+	if writeErr := os.WriteFile(to, data, 0o666); writeErr != nil {
+		return nil, r.fsError(writeErr, "copyfile", to)
+	}
+	return goja.Undefined(), nil
+}
+
+func (r *Runtime) pathArg(args []goja.Value, i int) (string, *goja.Object) {
+	if i >= len(args) {
+		return "", r.newError("TypeError", "The \"path\" argument must be of type string", map[string]any{"code": "ERR_INVALID_ARG_TYPE"})
+	}
+	path, ok := args[i].Export().(string)
+	if !ok {
+		return "", r.newError("TypeError", "The \"path\" argument must be of type string", map[string]any{"code": "ERR_INVALID_ARG_TYPE"})
+	}
+	return path, nil
+}
+
+// boolOption reads an option from an options object argument.
+func (r *Runtime) boolOption(args []goja.Value, i int, name string) bool {
+	if i >= len(args) {
+		return false
+	}
+	options, ok := args[i].(*goja.Object)
+	if !ok {
+		return false
+	}
+	value := options.Get(name)
+	return value != nil && value.ToBoolean()
+}
+
+// fsErrors are the Node.js codes and descriptions of common errors.
+var fsErrors = []struct {
+	target      error
+	code        string
+	description string
+}{
+	{fs.ErrNotExist, "ENOENT", "no such file or directory"},
+	{fs.ErrExist, "EEXIST", "file already exists"},
+	{fs.ErrPermission, "EACCES", "permission denied"},
+	{syscall.EISDIR, "EISDIR", "illegal operation on a directory"},
+	{syscall.ENOTDIR, "ENOTDIR", "not a directory"},
+	{syscall.ENOTEMPTY, "ENOTEMPTY", "directory not empty"},
+}
+
+// fsError converts a Go error to an error like the ones of Node's fs module,
+// such as "ENOENT: no such file or directory, open 'x.txt'".
+func (r *Runtime) fsError(err error, sys, path string) *goja.Object {
+	code, description := "EIO", err.Error()
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		description = pathErr.Err.Error()
+	}
+	for _, known := range fsErrors {
+		if errors.Is(err, known.target) {
+			code, description = known.code, known.description
+			break
+		}
+	}
+	message := code + ": " + description + ", " + sys + " '" + path + "'"
+	return r.newError("Error", message, map[string]any{"code": code, "syscall": sys, "path": path})
+}
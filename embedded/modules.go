@@ -0,0 +1,211 @@
+package embedded
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/sourcemap"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// builtinModules are the Node.js modules of the embedded runtime. They can
+// also be required with the node: prefix.
+var builtinModules = map[string]func(r *Runtime) *goja.Object{
+	"child_process": (*Runtime).newChildProcess,
+	"fs":            (*Runtime).newFS,
+	"path":          (*Runtime).newPath,
+}
+
+// moduleHeader starts the function that a module runs in, like in Node.js.
+const moduleHeader = "(function (exports, require, module, __filename, __dirname) {"
+
+// moduleWrapper writes a program as the body of the module function, so the
+// source map accounts for the header.
+type moduleWrapper struct {
+	program *ast.Program
+}
+
+func (mw *moduleWrapper) WriteTo(cw *ast.CodeWriter) {
+	cw.WriteString(moduleHeader)
+	mw.program.WriteTo(cw)
+	cw.WriteString("\n})")
+}
+
+func (r *Runtime) newModule(filename string) *goja.Object {
+	module := r.vm.NewObject()
+	_ = module.Set("id", filename)
+	_ = module.Set("filename", filename)
+	_ = module.Set("exports", r.vm.NewObject())
+	_ = module.Set("loaded", false)
+	return module
+}
+
+// runModule runs the source of a .djs, .js or .json file as a module.
+func (r *Runtime) runModule(module *goja.Object, filename string, source []byte) error {
+	var js string
+	switch filepath.Ext(filename) {
+	case ".json":
+		parse, _ := goja.AssertFunction(r.vm.Get("JSON").ToObject(r.vm).Get("parse"))
+		exports, err := parse(goja.Undefined(), r.vm.ToValue(string(source)))
+		if err != nil {
+			return err
+		}
+		_ = module.Set("exports", exports)
+		_ = module.Set("loaded", true)
+		return nil
+	case ".djs":
+		var err error
+		if js, err = r.transpile(filename, source); err != nil {
+			return err
+		}
+	default:
+		js = moduleHeader + string(source) + "\n})"
+	}
+
+	program, err := goja.Compile(filename, js, false)
+	if err != nil {
+		return err
+	}
+	fn, err := r.vm.RunProgram(program)
+	if err != nil {
+		return err
+	}
+	call, _ := goja.AssertFunction(fn)
+	dir := filepath.Dir(filename)
+	exports := module.Get("exports")
+	if _, err := call(exports, exports, r.newRequire(dir), module, r.vm.ToValue(filename), r.vm.ToValue(dir)); err != nil {
+		return err
+	}
+	_ = module.Set("loaded", true)
+	return nil
+}
+
+// transpile compiles a .djs file with an inline source map, so stack traces
+// point at the DJS source.
+func (r *Runtime) transpile(filename string, source []byte) (string, error) {
+	p := djsbuilder.NewWithOptions(lexer.NewBuilder(), r.opts.Build).Build(string(source))
+	program, err := p.ParseProgram()
+	if err != nil {
+		var messages []string
+		for _, perr := range p.Errors() {
+			messages = append(messages, fmt.Sprintf("%s:%d:%d: %s", filename, perr.Position.Line, perr.Position.Column, perr.Message))
+		}
+		return "", errors.New(strings.Join(messages, "\n"))
+	}
+	wrapped := &ast.Program{Statements: []ast.Statement{&moduleWrapper{program: program}}}
+	result := compiler.New().WithSourceMap().Compile(wrapped)
+	sm := result.SourceMap
+	if sm == nil {
+		sm = &sourcemap.SourceMap{Version: 3}
+	}
+	sm.Sources = []string{filename}
+	sm.SourcesContent = []string{string(source)}
+	smJSON, err := json.Marshal(sm)
+	if err != nil {
+		return "", err
+	}
+	return result.Code + "\n//# sourceMappingURL=data:application/json;charset=utf-8;base64," +
+		base64.StdEncoding.EncodeToString(smJSON), nil
+}
+
+// newRequire returns the require function of the modules in dir.
+func (r *Runtime) newRequire(dir string) *goja.Object {
+	require := r.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return r.require(call.Argument(0).String(), dir)
+	}).ToObject(r.vm)
+	_ = require.Set("resolve", func(call goja.FunctionCall) goja.Value {
+		id := call.Argument(0).String()
+		path, err := resolveModule(id, dir)
+		if err != nil {
+			panic(r.newError("Error", err.Error(), map[string]any{"code": "MODULE_NOT_FOUND"}))
+		}
+		return r.vm.ToValue(path)
+	})
+	return require
+}
+
+func (r *Runtime) require(id, dir string) goja.Value {
+	path, err := resolveModule(id, dir)
+	if err != nil {
+		panic(r.newError("Error", err.Error(), map[string]any{"code": "MODULE_NOT_FOUND"}))
+	}
+	if module, ok := r.modules[path]; ok {
+		return module.Get("exports")
+	}
+	module := r.newModule(path)
+	if name, ok := strings.CutPrefix(path, "node:"); ok {
+		_ = module.Set("exports", builtinModules[name](r))
+		_ = module.Set("loaded", true)
+		r.modules[path] = module
+		return module.Get("exports")
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		panic(r.fsError(err, "open", path))
+	}
+	// cached before it runs, so circular requires get the partial exports
+	r.modules[path] = module
+	if err := r.runModule(module, path, source); err != nil {
+		delete(r.modules, path)
+		var exception *goja.Exception
+		var interrupted *goja.InterruptedError
+		if errors.As(err, &exception) || errors.As(err, &interrupted) {
+			panic(err)
+		}
+		panic(r.newError("SyntaxError", err.Error(), nil))
+	}
+	return module.Get("exports")
+}
+
+// resolveModule returns the path of a required module, or "node:<name>" for
+// built-in modules. Imports of .djs files are emitted as imports of .js
+// files, so a .djs file is preferred to a .js file with the same name.
+func resolveModule(id, dir string) (string, error) {
+	if _, ok := builtinModules[strings.TrimPrefix(id, "node:")]; ok {
+		return "node:" + strings.TrimPrefix(id, "node:"), nil
+	}
+	local := id == "." || id == ".." || strings.HasPrefix(id, "./") || strings.HasPrefix(id, "../") || filepath.IsAbs(id)
+	if !local {
+		return "", fmt.Errorf("Cannot find module '%s' (the embedded runtime only loads local files and the fs, path and child_process modules)", id)
+	}
+	base := id
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(dir, id)
+	}
+	var candidates []string
+	if filepath.Ext(base) == ".js" {
+		candidates = append(candidates, strings.TrimSuffix(base, ".js")+".djs")
+	}
+	candidates = append(candidates, base, base+".djs", base+".js", base+".json",
+		filepath.Join(base, "index.djs"), filepath.Join(base, "index.js"))
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find module '%s'", id)
+}
+
+// newError creates a JavaScript error, such as a TypeError, with extra
+// properties.
+func (r *Runtime) newError(constructor, message string, props map[string]any) *goja.Object {
+	err, newErr := r.vm.New(r.vm.Get(constructor), r.vm.ToValue(message))
+	if newErr != nil {
+		panic(newErr)
+	}
+	for key, value := range props {
+		_ = err.Set(key, value)
+	}
+	return err
+}
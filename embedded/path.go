@@ -0,0 +1,94 @@
+package embedded
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// newPath returns the path module. Like Node's path, it uses the separators
+// of the host platform.
+func (r *Runtime) newPath() *goja.Object {
+	path := r.vm.NewObject()
+	_ = path.Set("sep", string(filepath.Separator))
+	_ = path.Set("delimiter", string(filepath.ListSeparator))
+	_ = path.Set("join", func(parts ...string) string {
+		if joined := filepath.Join(parts...); joined != "" {
+			return joined
+		}
+		return "."
+	})
+	_ = path.Set("resolve", resolvePath)
+	_ = path.Set("normalize", func(p string) string {
+		if p == "" {
+			return "."
+		}
+		return filepath.Clean(p)
+	})
+	_ = path.Set("isAbsolute", filepath.IsAbs)
+	_ = path.Set("dirname", filepath.Dir)
+	_ = path.Set("basename", func(p string, ext goja.Value) string {
+		base := filepath.Base(p)
+		if base == string(filepath.Separator) || p == "" {
+			return ""
+		}
+		if ext != nil && !goja.IsUndefined(ext) && base != ext.String() {
+			base = strings.TrimSuffix(base, ext.String())
+		}
+		return base
+	})
+	_ = path.Set("extname", extname)
+	_ = path.Set("relative", func(from, to string) (string, error) {
+		return filepath.Rel(resolvePath(from), resolvePath(to))
+	})
+	_ = path.Set("parse", func(p string) map[string]any {
+		base := filepath.Base(p)
+		if p == "" {
+			base = ""
+		}
+		dir := filepath.Dir(p)
+		if !strings.ContainsRune(p, filepath.Separator) {
+			dir = ""
+		}
+		root := ""
+		if filepath.IsAbs(p) {
+			root = filepath.VolumeName(p) + string(filepath.Separator)
+		}
+		ext := extname(p)
+		return map[string]any{
+			"root": root,
+			"dir":  dir,
+			"base": base,
+			"ext":  ext,
+			"name": strings.TrimSuffix(base, ext),
+		}
+	})
+	return path
+}
+
+// resolvePath resolves paths from right to left until an absolute path is
+// formed, starting from the working directory.
+func resolvePath(parts ...string) string {
+	resolved := ""
+	for i := len(parts) - 1; i >= 0 && !filepath.IsAbs(resolved); i-- {
+		resolved = filepath.Join(parts[i], resolved)
+	}
+	if !filepath.IsAbs(resolved) {
+		if cwd, err := os.Getwd(); err == nil {
+			resolved = filepath.Join(cwd, resolved)
+		}
+	}
+	return filepath.Clean(resolved)
+}
+
+// extname is like filepath.Ext, but names such as ".bashrc" have no
+// extension, as in Node.js.
+func extname(p string) string {
+	base := filepath.Base(p)
+	if strings.LastIndexByte(base, '.') <= 0 {
+		return ""
+	}
+	return filepath.Ext(base)
+}
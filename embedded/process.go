@@ -0,0 +1,75 @@
+package embedded
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+func (r *Runtime) newProcess() *goja.Object {
+	process := r.vm.NewObject()
+	env := r.vm.NewObject()
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok && key != "" {
+			_ = env.Set(key, value)
+		}
+	}
+	_ = process.Set("env", env)
+	_ = process.Set("argv", []any{executable()})
+	_ = process.Set("execPath", executable())
+	_ = process.Set("pid", os.Getpid())
+	_ = process.Set("platform", platform())
+	_ = process.Set("exitCode", goja.Undefined())
+	_ = process.Set("exit", func(call goja.FunctionCall) goja.Value {
+		code := r.exitCode()
+		if arg := call.Argument(0); !goja.IsUndefined(arg) {
+			code = int(arg.ToInteger())
+		}
+		// the program stops at the next instruction, like in Node.js
+		r.exit = &code
+		r.vm.Interrupt(exitRequest(code))
+		return goja.Undefined()
+	})
+	_ = process.Set("cwd", func() (string, error) { return os.Getwd() })
+	_ = process.Set("nextTick", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(r.vm.NewTypeError("the callback argument must be a function"))
+		}
+		var args []goja.Value
+		if len(call.Arguments) > 1 {
+			args = call.Arguments[1:]
+		}
+		r.enqueue(func() { r.call(fn, args...) })
+		return goja.Undefined()
+	})
+	_ = process.Set("stdout", r.newStream(r.opts.Stdout))
+	_ = process.Set("stderr", r.newStream(r.opts.Stderr))
+	return process
+}
+
+// newStream returns a writable stream with only a write method.
+func (r *Runtime) newStream(w io.Writer) *goja.Object {
+	stream := r.vm.NewObject()
+	_ = stream.Set("write", func(call goja.FunctionCall) goja.Value {
+		if _, err := io.WriteString(w, call.Argument(0).String()); err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+		if cb, ok := goja.AssertFunction(call.Argument(len(call.Arguments) - 1)); ok {
+			r.enqueue(func() { r.call(cb) })
+		}
+		return r.vm.ToValue(true)
+	})
+	return stream
+}
+
+// platform returns process.platform, which is "win32" on Windows.
+func platform() string {
+	if runtime.GOOS == "windows" {
+		return "win32"
+	}
+	return runtime.GOOS
+}
@@ -0,0 +1,395 @@
+// Package embedded runs DJS programs in the goja JavaScript VM, with a basic
+// Node.js compatible layer, so programs run where Node.js is not installed.
+//
+// The layer provides console, require for local .djs, .js and .json files,
+// process (argv, env, exit, exitCode, cwd, stdout, stderr, nextTick), timers
+// and an event loop, and subsets of the fs, path and child_process modules.
+package embedded
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// Options configures a Runtime.
+type Options struct {
+	// Build configures how .djs files are transpiled. Modules are always
+	// emitted as CommonJS.
+	Build djsbuilder.Options
+	// Args are the program arguments, which follow the program path in
+	// process.argv.
+	Args []string
+	// Stdin, Stdout and Stderr default to the standard streams of djs.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+}
+
+// Runtime runs one program. It must not be reused.
+type Runtime struct {
+	vm      *goja.Runtime
+	opts    Options
+	modules map[string]*goja.Object // module objects by path, or "node:<name>"
+	process *goja.Object
+	exit    *int // set by process.exit
+
+	// event loop
+	timers     []*timer
+	nextTimer  int64
+	callbacks  []func() // queued by the loop goroutine
+	jobs       chan func()
+	pending    int // goroutines that will send a job
+	rejections []*goja.Promise
+}
+
+// exitRequest interrupts the VM when the program calls process.exit.
+type exitRequest int
+
+type timer struct {
+	id       int64
+	when     time.Time
+	interval time.Duration // zero for timeouts
+	fn       goja.Callable
+	args     []goja.Value
+	ref      bool
+}
+
+// New returns a runtime with the Node.js compatible globals installed.
+func New(opts Options) *Runtime {
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	opts.Build.Module = djsbuilder.ModuleCommonJS
+	opts.Build.RequireImports = true
+
+	r := &Runtime{
+		vm:      goja.New(),
+		opts:    opts,
+		modules: map[string]*goja.Object{},
+		jobs:    make(chan func(), 16),
+	}
+	r.vm.SetPromiseRejectionTracker(r.trackRejection)
+	_ = r.vm.Set("console", r.newConsole())
+	r.process = r.newProcess()
+	_ = r.vm.Set("process", r.process)
+	_ = r.vm.Set("setTimeout", r.setTimer(false))
+	_ = r.vm.Set("setInterval", r.setTimer(true))
+	_ = r.vm.Set("setImmediate", func(call goja.FunctionCall) goja.Value {
+		args := append([]goja.Value{call.Argument(0), r.vm.ToValue(0)}, call.Arguments[min(1, len(call.Arguments)):]...)
+		return r.setTimer(false)(goja.FunctionCall{Arguments: args})
+	})
+	_ = r.vm.Set("clearTimeout", r.clearTimer)
+	_ = r.vm.Set("clearInterval", r.clearTimer)
+	_ = r.vm.Set("clearImmediate", r.clearTimer)
+	_ = r.vm.Set("global", r.vm.GlobalObject())
+	return r
+}
+
+// RunMain runs a DJS program and its event loop, and returns its exit code.
+// Errors are reported on the runtime's stderr.
+func (r *Runtime) RunMain(filename string, source []byte) int {
+	module := r.newModule(filename)
+	argv := []any{executable(), filename}
+	for _, arg := range r.opts.Args {
+		argv = append(argv, arg)
+	}
+	_ = r.process.Set("argv", argv)
+	_ = r.process.Set("mainModule", module)
+	if err := r.runModule(module, filename, source); err != nil {
+		return r.fail(err)
+	}
+	if r.exit != nil {
+		return *r.exit
+	}
+	return r.loop()
+}
+
+// loop runs timers and callbacks until nothing keeps the program alive.
+func (r *Runtime) loop() int {
+	for {
+		// process.exit may be a callback itself, so no instruction follows
+		// to interrupt the VM
+		if r.exit != nil {
+			return *r.exit
+		}
+		if code, failed := r.checkRejections(); failed {
+			return code
+		}
+		if len(r.callbacks) > 0 {
+			fn := r.callbacks[0]
+			r.callbacks = r.callbacks[1:]
+			if err := r.guard(fn); err != nil {
+				return r.fail(err)
+			}
+			continue
+		}
+		next := r.nextDue()
+		if next == nil && r.pending == 0 {
+			break
+		}
+
+		var due <-chan time.Time
+		var wait *time.Timer
+		if next != nil {
+			wait = time.NewTimer(time.Until(next.when))
+			due = wait.C
+		}
+		var err error
+		select {
+		case job := <-r.jobs:
+			r.pending--
+			err = r.guard(job)
+		case <-due:
+			err = r.guard(func() { r.fire(next) })
+		}
+		if wait != nil {
+			wait.Stop()
+		}
+		if err != nil {
+			return r.fail(err)
+		}
+	}
+	return r.exitCode()
+}
+
+// guard runs fn, turning JavaScript exceptions thrown by callbacks into
+// errors.
+func (r *Runtime) guard(fn func()) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			switch e := x.(type) {
+			case *goja.Exception:
+				err = e
+			case *goja.InterruptedError:
+				err = e
+			default:
+				panic(x)
+			}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// call calls a JavaScript callback from the event loop.
+func (r *Runtime) call(fn goja.Callable, args ...goja.Value) {
+	if _, err := fn(goja.Undefined(), args...); err != nil {
+		panic(err)
+	}
+}
+
+// enqueue runs fn on the next turn of the event loop.
+func (r *Runtime) enqueue(fn func()) {
+	r.callbacks = append(r.callbacks, fn)
+}
+
+// async runs work on another goroutine, and then done on the event loop,
+// which stays alive until then.
+func (r *Runtime) async(work func() func()) {
+	r.pending++
+	go func() {
+		r.jobs <- work()
+	}()
+}
+
+// nextDue returns the timer that fires first, in creation order when several
+// are due at the same time, or nil if no timer keeps the program alive.
+func (r *Runtime) nextDue() *timer {
+	var next *timer
+	alive := false
+	for _, t := range r.timers {
+		alive = alive || t.ref
+		if next == nil || t.when.Before(next.when) {
+			next = t
+		}
+	}
+	if !alive {
+		return nil
+	}
+	return next
+}
+
+func (r *Runtime) fire(t *timer) {
+	if t.interval > 0 {
+		t.when = time.Now().Add(t.interval)
+	} else {
+		r.removeTimer(t)
+	}
+	r.call(t.fn, t.args...)
+}
+
+func (r *Runtime) removeTimer(t *timer) {
+	for i, other := range r.timers {
+		if other == t {
+			r.timers = append(r.timers[:i], r.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *Runtime) setTimer(repeat bool) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(r.vm.NewTypeError("the callback argument must be a function"))
+		}
+		delay := time.Duration(call.Argument(1).ToFloat() * float64(time.Millisecond))
+		if delay < time.Millisecond {
+			delay = time.Millisecond
+		}
+		r.nextTimer++
+		t := &timer{id: r.nextTimer, when: time.Now().Add(delay), fn: fn, ref: true}
+		if len(call.Arguments) > 2 {
+			t.args = call.Arguments[2:]
+		}
+		if repeat {
+			t.interval = delay
+		}
+		r.timers = append(r.timers, t)
+
+		// like in Node.js, the handle converts to the timer id
+		handle := r.vm.NewObject()
+		_ = handle.Set("ref", func() goja.Value { t.ref = true; return handle })
+		_ = handle.Set("unref", func() goja.Value { t.ref = false; return handle })
+		_ = handle.Set("hasRef", func() bool { return t.ref })
+		_ = handle.SetSymbol(goja.SymToPrimitive, func() int64 { return t.id })
+		return handle
+	}
+}
+
+func (r *Runtime) clearTimer(call goja.FunctionCall) goja.Value {
+	arg := call.Argument(0)
+	if goja.IsUndefined(arg) || goja.IsNull(arg) {
+		return goja.Undefined()
+	}
+	id := arg.ToInteger()
+	for _, t := range r.timers {
+		if t.id == id {
+			r.removeTimer(t)
+			break
+		}
+	}
+	return goja.Undefined()
+}
+
+func (r *Runtime) trackRejection(p *goja.Promise, op goja.PromiseRejectionOperation) {
+	if op == goja.PromiseRejectionReject {
+		r.rejections = append(r.rejections, p)
+		return
+	}
+	for i, other := range r.rejections {
+		if other == p {
+			r.rejections = append(r.rejections[:i], r.rejections[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkRejections fails like Node.js when a promise was rejected and no
+// handler was attached by the end of the turn.
+func (r *Runtime) checkRejections() (int, bool) {
+	if len(r.rejections) == 0 {
+		return 0, false
+	}
+	reason := r.rejections[0].Result()
+	fmt.Fprintln(r.opts.Stderr, "Uncaught (in promise) "+r.errorText(reason))
+	return 1, true
+}
+
+// exitCode returns process.exitCode, or 0.
+func (r *Runtime) exitCode() int {
+	code := r.process.Get("exitCode")
+	if code == nil || goja.IsUndefined(code) || goja.IsNull(code) {
+		return 0
+	}
+	return int(code.ToInteger())
+}
+
+// fail reports an error that ended the program, and returns the exit code.
+func (r *Runtime) fail(err error) int {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if code, ok := interrupted.Value().(exitRequest); ok {
+			return int(code)
+		}
+	}
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		text := r.errorText(exception.Value())
+		if !strings.Contains(text, "\n    at ") {
+			text += formatStack(exception.Stack())
+		}
+		fmt.Fprintln(r.opts.Stderr, "Uncaught "+text)
+		return 1
+	}
+	fmt.Fprintln(r.opts.Stderr, err)
+	return 1
+}
+
+// errorText formats a thrown value, with the stack trace of errors.
+func (r *Runtime) errorText(value goja.Value) string {
+	if obj, ok := value.(*goja.Object); ok && obj.ClassName() == "Error" {
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			return nodeStack(stack.String())
+		}
+	}
+	return Inspect(r.vm, value)
+}
+
+// nodeStack rewrites a goja stack trace in the format of Node.js.
+func nodeStack(stack string) string {
+	lines := strings.Split(strings.TrimRight(stack, "\n"), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "\tat ") {
+			lines[i] = "    at " + trimProgramCounter(strings.TrimPrefix(line, "\tat "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatStack(frames []goja.StackFrame) string {
+	var sb strings.Builder
+	for _, frame := range frames {
+		pos := frame.Position()
+		if pos.Filename == "" {
+			continue
+		}
+		sb.WriteString("\n    at ")
+		if name := frame.FuncName(); name != "" {
+			fmt.Fprintf(&sb, "%s (%s:%d:%d)", name, pos.Filename, pos.Line, pos.Column)
+		} else {
+			fmt.Fprintf(&sb, "%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+		}
+	}
+	return sb.String()
+}
+
+// programCounter matches the bytecode offset goja adds after positions.
+var programCounter = regexp.MustCompile(`:(\d+)\(\d+\)(\)?)$`)
+
+// trimProgramCounter removes the bytecode offset from a stack frame:
+// "f (file.djs:1:2(3))" becomes "f (file.djs:1:2)".
+func trimProgramCounter(frame string) string {
+	return programCounter.ReplaceAllString(frame, ":$1$2")
+}
+
+func executable() string {
+	if path, err := os.Executable(); err == nil {
+		return path
+	}
+	return os.Args[0]
+}
@@ -0,0 +1,163 @@
+package embedded
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunMain(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string // main.djs and the files it requires
+		args   []string
+		code   int
+		stdout string
+		stderr string // a substring of the error output, where {dir} is the program directory
+	}{
+		{
+			name:   "console formatting",
+			files:  map[string]string{"main.djs": `console.log("%s is %d", "x", 42, {a: [1, "b"]}, null)`},
+			stdout: "x is 42 { a: [ 1, 'b' ] } null\n",
+		},
+		{
+			name: "require chains",
+			files: map[string]string{
+				"main.djs":      "import { greet } from './lib.djs'\nimport data from './data.json'\nconsole.log(greet(data.name))",
+				"lib.djs":       "import { suffix } from './util/index.js'\nexport function greet(name) { return 'hi ' + name + suffix }",
+				"util/index.js": "exports.suffix = '!'",
+				"data.json":     `{"name": "djs"}`,
+			},
+			stdout: "hi djs!\n",
+		},
+		{
+			name:   "dynamic import",
+			files:  map[string]string{"main.djs": "let lib = await import('./lib.djs')\nconsole.log(lib.n)", "lib.djs": "export let n = 7"},
+			stdout: "7\n",
+		},
+		{
+			name:   "timers and microtasks",
+			files:  map[string]string{"main.djs": "setTimeout(function() { console.log('timeout') }, 5)\nsetImmediate(function() { console.log('immediate') })\nPromise.resolve().then(function() { console.log('micro') })\nlet n = 0\nlet i = setInterval(function() {\n  n++\n  if (n == 3) {\n    clearInterval(i)\n    console.log('interval', n)\n  }\n}, 1)\nconsole.log('sync')"},
+			stdout: "sync\nmicro\nimmediate\ninterval 3\ntimeout\n",
+		},
+		{
+			name:   "unref timers don't keep the program alive",
+			files:  map[string]string{"main.djs": "setTimeout(function() { console.log('never') }, 1000).unref()"},
+			stdout: "",
+		},
+		{
+			name:   "process argv and exit",
+			files:  map[string]string{"main.djs": "console.log(process.argv.slice(2).join(','))\nprocess.exit(3)\nconsole.log('unreachable')"},
+			args:   []string{"a", "b"},
+			code:   3,
+			stdout: "a,b\n",
+		},
+		{
+			name:  "process exitCode",
+			files: map[string]string{"main.djs": "process.exitCode = 4"},
+			code:  4,
+		},
+		{
+			name:   "defer and await",
+			files:  map[string]string{"main.djs": "defer console.log('closed')\nlet v = await new Promise(function(resolve) { setTimeout(resolve, 1, 'done') })\nconsole.log(v)"},
+			stdout: "done\nclosed\n",
+		},
+		{
+			name:   "fs and path",
+			files:  map[string]string{"main.djs": "import fs from 'fs'\nimport path from 'node:path'\nlet dir = path.join(__dirname, 'out', 'nested')\nfs.mkdirSync(dir, { recursive: true })\nlet file = path.join(dir, 'a.txt')\nfs.writeFileSync(file, 'one')\nfs.appendFileSync(file, ' two')\nconsole.log(fs.readFileSync(file, 'utf8'), fs.statSync(file).size, fs.readdirSync(dir))\nconsole.log(path.basename(file, '.txt'), path.extname(file), path.relative(__dirname, file))\ntry { fs.readFileSync('missing.txt') } catch (err) { console.log(err.code, err.message) }\nconsole.log(await fs.promises.readFile(file) == 'one two')"},
+			stdout: "one two 7 [ 'a.txt' ]\na .txt out/nested/a.txt\nENOENT ENOENT: no such file or directory, open 'missing.txt'\ntrue\n",
+		},
+		{
+			name:   "child processes",
+			files:  map[string]string{"main.djs": "import { execSync } from 'child_process'\nconsole.log(execSync('echo hi').trim())\ntry { execSync('exit 2') } catch (err) { console.log('status', err.status) }"},
+			stdout: "hi\nstatus 2\n",
+		},
+		{
+			name:   "shell tag",
+			files:  map[string]string{"main.djs": "let name = 'a b'\nlet out = await sh`echo ${name}`\nconsole.log(out.stdout.trim(), out.code)"},
+			stdout: "a b 0\n",
+		},
+		{
+			name:   "uncaught errors point at the DJS source",
+			files:  map[string]string{"main.djs": "function fail() {\n  throw new Error('boom')\n}\nfail()"},
+			code:   1,
+			stderr: "Uncaught Error: boom\n    at fail ({dir}/main.djs:2:11)",
+		},
+		{
+			name:   "unhandled rejections",
+			files:  map[string]string{"main.djs": "Promise.reject(new Error('nope'))\nsetTimeout(function() { console.log('never') }, 1)"},
+			code:   1,
+			stderr: "Uncaught (in promise) Error: nope",
+		},
+		{
+			name:   "missing modules",
+			files:  map[string]string{"main.djs": "import './missing.djs'"},
+			code:   1,
+			stderr: "Cannot find module './missing.js'",
+		},
+		{
+			name:   "syntax errors in required modules",
+			files:  map[string]string{"main.djs": "import './lib.djs'", "lib.djs": "let = 1"},
+			code:   1,
+			stderr: "lib.djs:1:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var stdout, stderr bytes.Buffer
+			r := New(Options{Args: tt.args, Stdout: &stdout, Stderr: &stderr})
+			code := r.RunMain(filepath.Join(dir, "main.djs"), []byte(tt.files["main.djs"]))
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.code, stderr.String())
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.stdout)
+			}
+			if want := strings.ReplaceAll(tt.stderr, "{dir}", dir); !strings.Contains(stderr.String(), want) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	r := New(Options{})
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`'it\'s'`, `'it\'s'`},
+		{`10n`, `10n`},
+		{`[1, [2, [3, [4]]]]`, `[ 1, [ 2, [ 3, [Array] ] ] ]`},
+		{`({a: {b: {c: {d: 1}}}})`, `{ a: { b: { c: [Object] } } }`},
+		{`(() => { let o = {}; o.self = o; return o })()`, `{ self: [Circular] }`},
+		{`new Map([['k', 1]])`, `Map(1) { 'k' => 1 }`},
+		{`new Set([1])`, `Set(1) { 1 }`},
+		{`(function named() {})`, `[Function: named]`},
+		{`({'a-b': 1})`, `{ 'a-b': 1 }`},
+		{`Promise.resolve(2)`, `Promise { 2 }`},
+		{`new (class Point { constructor() { this.x = 1 } })()`, `Point { x: 1 }`},
+	}
+	for _, tt := range tests {
+		value, err := r.vm.RunString(tt.source)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.source, err)
+		}
+		if got := Inspect(r.vm, value); got != tt.want {
+			t.Errorf("Inspect(%s) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/plugins"
+)
+
+// moduleGraph is a DJS entry file and the .djs files it imports, directly or
+// indirectly. Each file is parsed once, until it changes, and files whose
+// compiled code is in the cache aren't parsed at all.
+type moduleGraph struct {
+	opts    djsbuilder.Options
+	entry   string
+	modules map[string]*parsedModule // by absolute path
+}
+
+type parsedModule struct {
+	code     []byte
+	program  *ast.Program
+	errs     []parser.ParserError
+	imports  []string          // the imported .djs files, as written in the source
+	deps     []string          // absolute paths of the imported .djs files
+	features []plugins.Feature // the features that need a recent Node.js
+	js       string            // the compiled file, once compiled
+	cached   bool              // true if the compiled file is in the cache
+	missing  bool              // true if the file could not be read
+}
+
+func newModuleGraph(entry string, opts djsbuilder.Options) *moduleGraph {
+	return &moduleGraph{opts: opts, entry: entry, modules: map[string]*parsedModule{}}
+}
+
+func (g *moduleGraph) module(path string) *parsedModule {
+	if m, ok := g.modules[path]; ok {
+		return m
+	}
+	m := &parsedModule{}
+	g.modules[path] = m
+	code, err := os.ReadFile(path)
+	if err != nil {
+		m.missing = true
+		return m
+	}
+	m.code = code
+	if cached, ok := readCachedModule(compiledPath(path, code, g.opts)); ok {
+		m.cached = true
+		m.setImports(path, cached.imports)
+		m.features = cached.features
+		return m
+	}
+	p := djsbuilder.NewWithOptions(lexer.NewBuilder(), g.opts).Build(string(code))
+	program, err := p.ParseProgram()
+	if err != nil {
+		m.errs = p.Errors()
+		return m
+	}
+	m.setProgram(path, program)
+	return m
+}
+
+// add adds a file that is already parsed and compiled.
+func (g *moduleGraph) add(path string, code []byte, program *ast.Program, js string) {
+	m := &parsedModule{code: code, js: js}
+	m.setProgram(path, program)
+	g.modules[path] = m
+}
+
+func (m *parsedModule) setProgram(path string, program *ast.Program) {
+	m.program = program
+	m.setImports(path, plugins.ModuleDependencies(program))
+	m.features = plugins.ProgramFeatures(program)
+}
+
+func (m *parsedModule) setImports(path string, imports []string) {
+	m.imports = imports
+	for _, imp := range imports {
+		m.deps = append(m.deps, filepath.Join(filepath.Dir(path), filepath.FromSlash(imp)))
+	}
+}
+
+// files returns the entry file and its dependencies, parsing the files that
+// changed since the last call.
+func (g *moduleGraph) files() []string {
+	var files []string
+	seen := map[string]bool{}
+	queue := []string{g.entry}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+		queue = append(queue, g.module(path).deps...)
+	}
+	return files
+}
+
+// invalidate discards the parsed files, so they are parsed again.
+func (g *moduleGraph) invalidate(paths []string) {
+	for _, path := range paths {
+		delete(g.modules, path)
+	}
+}
+
+// features returns the features used by the files in the graph.
+func (g *moduleGraph) features() []plugins.Feature {
+	var features []plugins.Feature
+	seen := map[plugins.Feature]bool{}
+	for _, path := range g.files() {
+		for _, f := range g.module(path).features {
+			if !seen[f] {
+				seen[f] = true
+				features = append(features, f)
+			}
+		}
+	}
+	return features
+}
+
+// report prints the errors of every file in the graph, and reports whether
+// all the files parsed, so the program can run.
+func (g *moduleGraph) report() bool {
+	ok := true
+	for _, path := range g.files() {
+		m := g.module(path)
+		if m.missing {
+			fmt.Fprintf(os.Stderr, "%s: file not found\n", path)
+		}
+		for _, perr := range m.errs {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", path, perr.Position.Line, perr.Position.Column, perr.Message)
+		}
+		ok = ok && (m.program != nil || m.cached)
+	}
+	return ok
+}
+
+// compile writes the compiled code of every file in the graph to the cache
+// directory, where the Node.js loader finds it, unless it is already there,
+// with the list of its imports.
+func (g *moduleGraph) compile() error {
+	for _, path := range g.files() {
+		m := g.module(path)
+		if m.program == nil {
+			continue
+		}
+		compiled := compiledPath(path, m.code, g.opts)
+		if _, err := os.Stat(compiled); err == nil {
+			// compiled by the loader, or by another run
+			if err := writeCachedModule(compiled, cachedModule{m.imports, m.features}); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.js == "" {
+			result := compiler.New().WithSourceMap().Compile(m.program)
+			js, err := executionJS(result, m.code, path, deriveOutputFilename(path, executionExt(g.opts.Module)))
+			if err != nil {
+				return err
+			}
+			m.js = js
+		}
+		if _, err := writeCompiledJS(path, m.code, g.opts, m.js); err != nil {
+			return err
+		}
+		if err := writeCachedModule(compiled, cachedModule{m.imports, m.features}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
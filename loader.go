@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// Node.js runs DJS files from their own paths: a preloaded loader reads the
+// compiled code of each .djs file from the cache directory, so relative
+// requires and imports are resolved from the DJS files, and nothing is
+// written next to them. djs compiles the entry file and the .djs files it
+// imports before Node.js starts; files required dynamically are transpiled by
+// calling djs from the loader, once per version of the file.
+//
+// The compiled code of a file is found by a hash of its path, the version of
+// djs, the options and its source, computed in the same way by compiledPath
+// and the loader (see cache.go).
+
+// loaderEnv passes the loaderConfig to the loader, as JSON.
+const loaderEnv = "DJS_LOADER"
+
+type loaderConfig struct {
+	Cache   string   `json:"cache"`   // directory of the compiled files
+	Options string   `json:"options"` // the version and options part of the hash
+	Ext     string   `json:"ext"`     // extension of the compiled files
+	DJS     string   `json:"djs"`     // djs executable, for files that aren't compiled yet
+	Flags   []string `json:"flags"`   // djs flags for the options
+}
+
+// compileLoader returns the compiled code of a .djs file, transpiling it
+// first if it isn't in the cache yet.
+const compileLoader = `"use strict";
+const childProcess = require("child_process");
+const crypto = require("crypto");
+const fs = require("fs");
+const path = require("path");
+
+module.exports = function compile(config, filename) {
+  const source = fs.readFileSync(filename);
+  const hash = crypto.createHash("sha256")
+    .update(filename + "\0" + config.options + "\0")
+    .update(source)
+    .digest("hex")
+    .slice(0, 16);
+  const compiled = path.join(config.cache, hash + config.ext);
+  if (!fs.existsSync(compiled)) {
+    fs.mkdirSync(config.cache, { recursive: true });
+    const tmp = compiled + "." + process.pid + ".tmp";
+    const args = config.flags.concat(["--json", "-o", tmp, "--inline-sourcemap", "--inline-sources", filename]);
+    const result = childProcess.spawnSync(config.djs, args, { encoding: "utf8" });
+    if (result.error) {
+      throw result.error;
+    }
+    if (result.status !== 0) {
+      let message = result.stderr.trim();
+      try {
+        message = JSON.parse(result.stdout).errors
+          .map((e) => filename + ":" + e.position.line + ":" + e.position.column + ": " + e.message)
+          .join("\n");
+      } catch (e) {
+        // not a syntax error
+      }
+      throw new SyntaxError(message);
+    }
+    fs.renameSync(tmp, compiled);
+  }
+  return fs.readFileSync(compiled, "utf8");
+};
+`
+
+// requireLoader is preloaded with --require for CommonJS programs. Imports
+// of .djs files are emitted as requires of .js files, which are resolved to
+// the .djs files when they exist. The requires of a program read from stdin
+// come from the "[stdin]" module.
+const requireLoader = `"use strict";
+const fs = require("fs");
+const path = require("path");
+const Module = require("module");
+const compile = require("./compile.cjs");
+const config = JSON.parse(process.env.` + loaderEnv + `);
+delete process.env.` + loaderEnv + `;
+
+Module._extensions[".djs"] = function (module, filename) {
+  module._compile(compile(config, filename), filename);
+};
+
+const resolveFilename = Module._resolveFilename;
+Module._resolveFilename = function (request, parent, ...rest) {
+  if (parent && parent.filename && (parent.filename.endsWith(".djs") || parent.id === "[stdin]") &&
+      /^\.\.?\//.test(request) && request.endsWith(config.ext)) {
+    const djs = path.resolve(path.dirname(parent.filename), request.slice(0, -config.ext.length) + ".djs");
+    if (fs.existsSync(djs)) {
+      return djs;
+    }
+  }
+  return resolveFilename.call(this, request, parent, ...rest);
+};
+`
+
+// registerLoader is preloaded with --import for ES module programs, and
+// registers esmHooks.
+const registerLoader = `import { register } from "node:module";
+const config = JSON.parse(process.env.` + loaderEnv + `);
+delete process.env.` + loaderEnv + `;
+register("./hooks.mjs", import.meta.url, { data: config });
+`
+
+// esmHooks resolve and load .djs files for ES module programs. The imports
+// of a program read from stdin come from the "[eval1]" module.
+const esmHooks = `import { existsSync } from "node:fs";
+import { fileURLToPath } from "node:url";
+import compile from "./compile.cjs";
+
+let config;
+
+export function initialize(data) {
+  config = data;
+}
+
+export async function resolve(specifier, context, nextResolve) {
+  if (context.parentURL && (context.parentURL.endsWith(".djs") || /\/\[eval\d*\]$/.test(context.parentURL)) &&
+      /^\.\.?\//.test(specifier) && specifier.endsWith(config.ext)) {
+    const url = new URL(specifier.slice(0, -config.ext.length) + ".djs", context.parentURL);
+    if (existsSync(fileURLToPath(url))) {
+      return { url: url.href, shortCircuit: true };
+    }
+  }
+  return nextResolve(specifier, context);
+}
+
+export async function load(url, context, nextLoad) {
+  if (!url.startsWith("file:") || !url.endsWith(".djs")) {
+    return nextLoad(url, context);
+  }
+  return { format: "module", source: compile(config, fileURLToPath(url)), shortCircuit: true };
+}
+`
+
+// loaderFiles are the loader scripts, by file name.
+var loaderFiles = map[string]string{
+	"compile.cjs":  compileLoader,
+	"require.cjs":  requireLoader,
+	"register.mjs": registerLoader,
+	"hooks.mjs":    esmHooks,
+}
+
+// installLoader writes the loader scripts, once per version of the scripts,
+// and returns their directory.
+func installLoader() (string, error) {
+	h := sha256.New()
+	for _, name := range []string{"compile.cjs", "require.cjs", "register.mjs", "hooks.mjs"} {
+		h.Write([]byte(name + "\x00" + loaderFiles[name] + "\x00"))
+	}
+	dir := filepath.Join(cacheDir(), "loader", hex.EncodeToString(h.Sum(nil))[:16])
+	for name, content := range loaderFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := writeFileAtomic(path, content); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// transpileFlags returns the djs flags that transpile files with opts.
+func transpileFlags(opts djsbuilder.Options) []string {
+	flags := []string{"--module", opts.Module}
+	if opts.Downlevel {
+		flags = append(flags, "--downlevel")
+	}
+	if opts.PreserveComments {
+		flags = append(flags, "--preserve-comments")
+	}
+	if opts.StripAsserts {
+		flags = append(flags, "--strip-asserts")
+	}
+	return flags
+}
+
+// nodeCommand returns the command that runs a DJS file in Node.js through
+// the loader, with the Node.js flags, source maps enabled, the program
+// arguments and the standard streams of djs. Programs read from stdin have no
+// file, so their compiled code at compiledPath is piped into `node -`, which
+// resolves requires and imports from the working directory.
+func nodeCommand(node nodeOptions, absInputPath, compiledPath string, opts djsbuilder.Options, args []string) (*exec.Cmd, error) {
+	loader, err := installLoader()
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(loaderConfig{
+		Cache:   filepath.Join(cacheDir(), "run"),
+		Options: optionsKey(opts),
+		Ext:     executionExt(opts.Module),
+		DJS:     djsExecutable(),
+		Flags:   transpileFlags(opts),
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodeArgs := append([]string{"--enable-source-maps"}, node.Flags...)
+	if opts.Module == djsbuilder.ModuleESM {
+		nodeArgs = append(nodeArgs, "--import", fileURL(filepath.Join(loader, "register.mjs")))
+	} else {
+		nodeArgs = append(nodeArgs, "--require", filepath.Join(loader, "require.cjs"))
+	}
+	var stdin []byte
+	if absInputPath == stdinPath {
+		if stdin, err = os.ReadFile(compiledPath); err != nil {
+			return nil, err
+		}
+		if opts.Module == djsbuilder.ModuleESM {
+			nodeArgs = append(nodeArgs, "--input-type=module")
+		}
+		nodeArgs = append(nodeArgs, "-")
+	} else {
+		nodeArgs = append(nodeArgs, absInputPath)
+	}
+	cmd := exec.Command(node.Path, append(nodeArgs, args...)...)
+	cmd.Env = append(os.Environ(), loaderEnv+"="+string(config))
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+func djsExecutable() string {
+	if path, err := os.Executable(); err == nil {
+		return path
+	}
+	return os.Args[0]
+}
+
+// fileURL returns the file: URL of an absolute path, which --import needs
+// on Windows.
+func fileURL(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
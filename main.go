@@ -4,22 +4,31 @@ import (
 	"bufio"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/rs/xid"
 	"github.com/xjslang/xjs/compiler"
 	"github.com/xjslang/xjs/lexer"
 	"github.com/xjslang/xjs/parser"
 	"github.com/xjslang/xjs/sourcemap"
 
 	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/embedded"
+	"github.com/xjslang/djs/plugins"
+)
+
+// stdinPath is the file name of programs read from stdin.
+const stdinPath = "<stdin>"
+
+// Runtimes that execute programs.
+const (
+	runtimeNode     = "node"
+	runtimeEmbedded = "embedded"
 )
 
 type ParserErrors struct {
@@ -31,6 +40,19 @@ func main() {
 }
 
 func run() int {
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		return runBuild(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		return runREPL(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		return runCache(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "launch-json" {
+		return runLaunchJSON(os.Args[2:])
+	}
+
 	var outputPath string
 	var generateSourceMap bool
 	var inlineSourceMap bool
@@ -39,6 +61,18 @@ func run() int {
 	var sourceRoot string
 	var jsonOutput bool
 	var checkOnly bool
+	var downlevel bool
+	var preserveComments bool
+	var moduleFormat string
+	var stripAsserts bool
+	var watchMode bool
+	var gracePeriod time.Duration
+	var nodeFlag string
+	var nodeFlags []string
+	var minNodeVersion string
+	inspect := inspectFlag{name: "inspect"}
+	inspectBrk := inspectFlag{name: "inspect-brk"}
+	var runtimeName string
 	flag.StringVar(&outputPath, "o", "", "Output file path (transpile only, do not execute)")
 	flag.BoolVar(&generateSourceMap, "sourcemap", false, "Generate external source map file (.map)")
 	flag.BoolVar(&inlineSourceMap, "inline-sourcemap", false, "Embed source map as base64 in output file")
@@ -47,14 +81,37 @@ func run() int {
 	flag.StringVar(&sourceRoot, "source-root", "", "Root path for source files (sourceRoot field in map)")
 	flag.BoolVar(&jsonOutput, "json", false, "Output errors in JSON format")
 	flag.BoolVar(&checkOnly, "check", false, "Check syntax only, do not execute or transpile")
+	flag.BoolVar(&downlevel, "downlevel", false, "Emit explicit null checks instead of ?., ?? and ??= (Node.js < 14)")
+	flag.StringVar(&moduleFormat, "module", djsbuilder.ModuleCommonJS, "Output format of import/export: cjs or esm")
+	flag.BoolVar(&preserveComments, "preserve-comments", false, "Keep license headers and JSDoc comments in the output")
+	flag.BoolVar(&stripAsserts, "strip-asserts", false, "Remove assert statements from the output (release builds)")
+	flag.BoolVar(&watchMode, "watch", false, "Restart the program when the file or the .djs files it imports change")
+	flag.DurationVar(&gracePeriod, "grace-period", defaultGracePeriod, "Time the program has to exit after djs forwards SIGINT, SIGTERM or SIGHUP, before it is killed")
+	flag.StringVar(&nodeFlag, "node", "", "Node.js executable (default: $"+nodeEnv+", or node from PATH)")
+	flag.Func("node-flag", "Pass a flag to Node.js, such as --max-old-space-size=4096 (repeatable)", func(value string) error {
+		if !strings.HasPrefix(value, "-") {
+			return fmt.Errorf("%q is not a flag", value)
+		}
+		nodeFlags = append(nodeFlags, value)
+		return nil
+	})
+	flag.Var(&inspect, "inspect", "Enable the Node.js inspector, on an optional `[host:]port` (default 127.0.0.1:9229)")
+	flag.Var(&inspectBrk, "inspect-brk", "Enable the Node.js inspector, and break before the program starts, on an optional `[host:]port`")
+	flag.StringVar(&minNodeVersion, "min-node-version", "", "Require at least this Node.js version, such as 18 or 20.6, besides the versions the program needs")
+	flag.StringVar(&runtimeName, "runtime", runtimeNode, "Runtime that executes the program: node or embedded (no Node.js required)")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file.djs]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file.djs [--] [args...]]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s build [options] <srcdir> -outdir <dir>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s repl\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s cache clean|stats\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s launch-json [file.djs]\n", filepath.Base(os.Args[0]))
 		fmt.Fprintln(os.Stderr, "\nIf no file is provided, reads from stdin.")
 		fmt.Fprintln(os.Stderr, "\nOptions:")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\nExamples:")
 		fmt.Fprintln(os.Stderr, "  djs input.djs                                                   # Transpile and execute")
+		fmt.Fprintln(os.Stderr, "  djs input.djs -- --verbose file.txt                             # Pass arguments to the program")
 		fmt.Fprintln(os.Stderr, "  djs --check input.djs                                           # Check syntax only")
 		fmt.Fprintln(os.Stderr, "  djs --check --json input.djs                                    # Check syntax, output JSON")
 		fmt.Fprintln(os.Stderr, "  cat input.djs | djs --check --json                              # Check from stdin")
@@ -65,23 +122,99 @@ func run() int {
 		fmt.Fprintln(os.Stderr, "  djs -o output.js --sourcemap --inline-sources input.djs         # With embedded sources")
 		fmt.Fprintln(os.Stderr, "  djs -o output.js --sourcemap --map-root /maps/ input.djs        # Map in /maps/ folder")
 		fmt.Fprintln(os.Stderr, "  djs -o output.js --sourcemap --source-root /src/ input.djs      # Source root prefix")
+		fmt.Fprintln(os.Stderr, "  djs -o output.js --downlevel input.djs                          # Target Node.js < 14")
+		fmt.Fprintln(os.Stderr, "  djs -o output.js --preserve-comments input.djs                  # Keep license and JSDoc")
+		fmt.Fprintln(os.Stderr, "  djs -o output.mjs --module esm input.djs                        # Emit ES modules")
+		fmt.Fprintln(os.Stderr, "  djs -o output.js --strip-asserts input.djs                      # Release build without asserts")
+		fmt.Fprintln(os.Stderr, "  djs --watch input.djs                                           # Restart on changes")
+		fmt.Fprintln(os.Stderr, "  djs --node-flag=--max-old-space-size=4096 input.djs             # Pass a flag to Node.js")
+		fmt.Fprintln(os.Stderr, "  djs --node ~/.nvm/versions/node/v22.0.0/bin/node input.djs      # Use another Node.js")
+		fmt.Fprintln(os.Stderr, "  djs --inspect-brk input.djs                                     # Debug with breakpoints in DJS")
+		fmt.Fprintln(os.Stderr, "  djs launch-json input.djs > .vscode/launch.json                 # Debug in VS Code")
+		fmt.Fprintln(os.Stderr, "  djs --runtime embedded input.djs                                # Execute without Node.js")
+		fmt.Fprintln(os.Stderr, "  djs build src/ -outdir dist/                                    # Build a directory tree")
+		fmt.Fprintln(os.Stderr, "  djs repl                                                        # Evaluate DJS interactively")
+		fmt.Fprintln(os.Stderr, "  djs cache stats                                                 # Show the compiled code cache")
 	}
 
 	flag.Parse()
 
-	// Accept 0 arguments (stdin) or 1 argument (file)
+	// Arguments after the file are passed to the program, like with node. A
+	// "--" right after the file only separates them, and is dropped
+	var scriptArgs []string
 	if flag.NArg() > 1 {
+		scriptArgs = flag.Args()[1:]
+		if scriptArgs[0] == "--" {
+			scriptArgs = scriptArgs[1:]
+		}
+	}
+	if flag.NArg() > 1 && (checkOnly || outputPath != "") {
 		fmt.Fprintln(os.Stderr, "Error: too many arguments")
 		flag.Usage()
 		return 2
 	}
 
+	if moduleFormat != djsbuilder.ModuleCommonJS && moduleFormat != djsbuilder.ModuleESM {
+		fmt.Fprintf(os.Stderr, "Error: --module must be %q or %q\n", djsbuilder.ModuleCommonJS, djsbuilder.ModuleESM)
+		return 2
+	}
+
+	// Validate the embedded runtime, which runs CommonJS only
+	if runtimeName != runtimeNode && runtimeName != runtimeEmbedded {
+		fmt.Fprintf(os.Stderr, "Error: --runtime must be %q or %q\n", runtimeNode, runtimeEmbedded)
+		return 2
+	}
+	if runtimeName == runtimeEmbedded && (checkOnly || outputPath != "" || watchMode) {
+		fmt.Fprintln(os.Stderr, "Error: --runtime embedded cannot be used with --check, -o or --watch")
+		return 2
+	}
+	if (nodeFlag != "" || len(nodeFlags) > 0 || minNodeVersion != "") && (runtimeName == runtimeEmbedded || checkOnly || outputPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: --node, --node-flag and --min-node-version only apply when running with Node.js")
+		return 2
+	}
+	if (inspect.enabled || inspectBrk.enabled) && (runtimeName == runtimeEmbedded || checkOnly || outputPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: --inspect and --inspect-brk only apply when running with Node.js")
+		return 2
+	}
+	if inspect.enabled && inspectBrk.enabled {
+		fmt.Fprintln(os.Stderr, "Error: --inspect and --inspect-brk are mutually exclusive")
+		return 2
+	}
+	for _, f := range []*inspectFlag{&inspect, &inspectBrk} {
+		if nf := f.nodeFlag(); nf != "" {
+			nodeFlags = append(nodeFlags, nf)
+		}
+	}
+	var minimumNode nodeVersion
+	if minNodeVersion != "" {
+		v, err := parseNodeVersion(minNodeVersion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --min-node-version: %v\n", err)
+			return 2
+		}
+		minimumNode = v
+	}
+	if runtimeName == runtimeEmbedded && moduleFormat == djsbuilder.ModuleESM {
+		fmt.Fprintln(os.Stderr, "Error: --runtime embedded cannot be used with --module esm")
+		return 2
+	}
+
 	// Validate mutually exclusive flags
 	if generateSourceMap && inlineSourceMap {
 		fmt.Fprintln(os.Stderr, "Error: --sourcemap and --inline-sourcemap are mutually exclusive")
 		return 2
 	}
 
+	// Validate --watch runs a file
+	if watchMode && (checkOnly || outputPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: --watch cannot be used with --check or -o (use djs build --watch)")
+		return 2
+	}
+	if watchMode && flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --watch requires a file")
+		return 2
+	}
+
 	// Validate --check is incompatible with -o and source map flags
 	if checkOnly && outputPath != "" {
 		fmt.Fprintln(os.Stderr, "Error: --check cannot be used with -o (transpile mode)")
@@ -137,7 +270,7 @@ func run() int {
 			return 1
 		}
 		inputCode = []byte(builder.String())
-		absInputPath = "<stdin>"
+		absInputPath = stdinPath
 	} else {
 		// Read from file
 		inputPath := flag.Arg(0)
@@ -155,16 +288,47 @@ func run() int {
 		}
 	}
 
-	// Only check for Node if we're going to execute
-	if !transpileOnly && !checkOnly {
-		if err := ensureNodeAvailable(); err != nil {
+	// Only check for Node if we're going to execute with it
+	node := nodeOptions{Path: nodePath(nodeFlag), Flags: nodeFlags}
+	if !transpileOnly && !checkOnly && runtimeName == runtimeNode {
+		reqs := nodeRequirements(moduleFormat == djsbuilder.ModuleESM, minimumNode)
+		version, err := findNodeVersion(node.Path)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Node.js not found: %v\n", err)
 			return 1
 		}
+		if err := checkNodeVersion(version, reqs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		node.Version = version
+	}
+
+	opts := djsbuilder.Options{
+		Downlevel:        downlevel,
+		PreserveComments: preserveComments,
+		Module:           moduleFormat,
+		StripAsserts:     stripAsserts,
+	}
+	if watchMode {
+		return runWatch(node, absInputPath, opts, scriptArgs, gracePeriod)
+	}
+
+	// A program that ran before, unchanged, runs from the cache without being
+	// parsed and compiled again
+	if !transpileOnly && !checkOnly && runtimeName == runtimeNode {
+		compiled := compiledPath(absInputPath, inputCode, opts)
+		if useStdin {
+			if _, ok := readCachedModule(compiled); ok {
+				return executeNode(node, absInputPath, nil, compiled, opts, scriptArgs, gracePeriod)
+			}
+		} else if _, ok := readCachedModule(compiled); ok {
+			return executeNode(node, absInputPath, newModuleGraph(absInputPath, opts), "", opts, scriptArgs, gracePeriod)
+		}
 	}
 
 	lb := lexer.NewBuilder()
-	p := djsbuilder.New(lb).Build(string(inputCode))
+	p := djsbuilder.NewWithOptions(lb, opts).Build(string(inputCode))
 
 	program, perr := p.ParseProgram()
 	if perr != nil {
@@ -191,6 +355,10 @@ func run() int {
 		return 0
 	}
 
+	if runtimeName == runtimeEmbedded {
+		return embedded.New(embedded.Options{Build: opts, Args: scriptArgs}).RunMain(absInputPath, inputCode)
+	}
+
 	// Generate source map when executing OR when explicitly requested
 	c := compiler.New()
 	if !transpileOnly || generateSourceMap || inlineSourceMap {
@@ -284,6 +452,68 @@ func run() int {
 	}
 
 	// Execute mode: prepare inline source map and run with Node
+	outFile := deriveOutputFilename(absInputPath, executionExt(moduleFormat))
+	finalJS, jerr := executionJS(result, inputCode, absInputPath, outFile)
+	if jerr != nil {
+		fmt.Fprintf(os.Stderr, "Error serializing source map: %v\n", jerr)
+		return 1
+	}
+
+	// The compiled code of the program and the .djs files it imports goes to
+	// the cache directory, and the loader runs it from the DJS files, so
+	// require() resolution stays relative to them
+	var compiledPath string
+	var graph *moduleGraph
+	if useStdin {
+		compiledPath, err = writeCompiledJS(absInputPath, inputCode, opts, finalJS)
+		if err == nil {
+			err = writeCachedModule(compiledPath, cachedModule{features: plugins.ProgramFeatures(program)})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing compiled JS: %v\n", err)
+			return 1
+		}
+	} else {
+		graph = newModuleGraph(absInputPath, opts)
+		graph.add(absInputPath, inputCode, program, finalJS)
+	}
+	return executeNode(node, absInputPath, graph, compiledPath, opts, scriptArgs, gracePeriod)
+}
+
+// executeNode runs a program in Node.js, with source maps enabled so runtime
+// errors map to the original DJS. Programs read from a file run from their
+// module graph, which is compiled to the cache directory first; the compiled
+// code of programs read from stdin, at compiledPath, is piped into Node.js.
+func executeNode(node nodeOptions, absInputPath string, graph *moduleGraph, compiledPath string, opts djsbuilder.Options, args []string, grace time.Duration) int {
+	if graph != nil {
+		if !graph.report() || !node.supports(graph.features()) {
+			return 1
+		}
+		if err := graph.compile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing compiled JS: %v\n", err)
+			return 1
+		}
+	} else if cached, ok := readCachedModule(compiledPath); ok && !node.supports(cached.features) {
+		return 1
+	}
+	cmd, err := nodeCommand(node, absInputPath, compiledPath, opts, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the Node.js loader: %v\n", err)
+		return 1
+	}
+	return runChild(cmd, grace)
+}
+
+func executionExt(moduleFormat string) string {
+	if moduleFormat == djsbuilder.ModuleESM {
+		return ".mjs"
+	}
+	return ".js"
+}
+
+// executionJS returns the compiled program with an inline source map that
+// includes the DJS source, so runtime errors map to the original lines.
+func executionJS(result compiler.CompileResult, inputCode []byte, absInputPath, outFile string) (string, error) {
 	// Enrich SourceMap with source metadata and file name
 	sm := result.SourceMap
 	if sm == nil {
@@ -293,16 +523,13 @@ func run() int {
 	sm.Sources = []string{absInputPath}
 	// Always include sources in execution mode for better error messages
 	sm.SourcesContent = []string{string(inputCode)}
-
 	// Determine output file name (for tooling); not strictly needed for inline maps
-	outFile := deriveOutputFilename(absInputPath)
 	sm.File = filepath.Base(outFile)
 
 	// Serialize SourceMap to base64 JSON and embed as inline comment
-	smJSON, jerr := json.Marshal(sm)
-	if jerr != nil {
-		fmt.Fprintf(os.Stderr, "Error serializing source map: %v\n", jerr)
-		return 1
+	smJSON, err := json.Marshal(sm)
+	if err != nil {
+		return "", err
 	}
 	b64 := base64.StdEncoding.EncodeToString(smJSON)
 
@@ -317,81 +544,12 @@ func run() int {
 	jsBuilder.WriteString("//# sourceMappingURL=data:application/json;charset=utf-8;base64,")
 	jsBuilder.WriteString(b64)
 	jsBuilder.WriteString("\n")
-
-	finalJS := jsBuilder.String()
-
-	// Write to a temporary JS file so Node can execute it with source maps
-	// Use the directory of the original DJS file to preserve require() resolution
-	inputDir := filepath.Dir(absInputPath)
-	tmpFile, terr := writeTempJS(inputDir, outFile, finalJS)
-	if terr != nil {
-		fmt.Fprintf(os.Stderr, "Error writing temp JS: %v\n", terr)
-		return 1
-	}
-	defer os.Remove(tmpFile)
-
-	// Execute with Node enabling source maps so runtime errors map to original DJS
-	cmd := exec.Command("node", "--enable-source-maps", tmpFile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		// Preserve Node’s exit code when possible
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			if exitErr.ProcessState != nil {
-				return exitErr.ProcessState.ExitCode()
-			}
-			return 1
-		}
-		fmt.Fprintf(os.Stderr, "Execution error: %v\n", err)
-		return 1
-	}
-
-	return 0
+	return jsBuilder.String(), nil
 }
 
-func ensureNodeAvailable() error {
-	cmd := exec.Command("node", "--version")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("node command not found or failed to execute")
-	}
-
-	version := strings.TrimSpace(string(output))
-	// Remove 'v' prefix if present (e.g., "v18.16.0" -> "18.16.0")
-	version = strings.TrimPrefix(version, "v")
-
-	// Parse version (format: major.minor.patch)
-	var major, minor int
-	_, err = fmt.Sscanf(version, "%d.%d", &major, &minor)
-	if err != nil {
-		return fmt.Errorf("unable to parse node version: %s", version)
-	}
-
-	// DJS requires Node.js 7.6+ for async/await support
-	if major < 7 || (major == 7 && minor < 6) {
-		return fmt.Errorf("node version %s is too old; DJS requires Node.js 7.6 or later for async/await support", version)
-	}
-
-	return nil
-}
-
-func deriveOutputFilename(inputPath string) string {
+func deriveOutputFilename(inputPath, outExt string) string {
 	base := filepath.Base(inputPath)
 	ext := filepath.Ext(base)
 	name := strings.TrimSuffix(base, ext)
-	return name + ".transpiled.js"
-}
-
-func writeTempJS(baseDir, outFileName, content string) (string, error) {
-	// Write temp file in the same directory as the original DJS file
-	// so Node.js can resolve relative requires and local node_modules
-	ext := filepath.Ext(outFileName)
-	base := strings.TrimSuffix(outFileName, ext)
-	uniqueFileName := base + "." + xid.New().String() + ext
-	tmpPath := filepath.Join(baseDir, uniqueFileName)
-	if err := os.WriteFile(tmpPath, []byte(content), 0o644); err != nil {
-		return "", err
-	}
-	return tmpPath, nil
+	return name + ".transpiled" + outExt
 }
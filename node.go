@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xjslang/djs/plugins"
+)
+
+// nodeEnv names the Node.js executable, when --node isn't given.
+const nodeEnv = "DJS_NODE"
+
+// nodeOptions configures the Node.js process that runs programs.
+type nodeOptions struct {
+	Path    string      // node executable
+	Flags   []string    // Node.js flags, passed before the program
+	Version nodeVersion // the version of node, once it is checked
+}
+
+// nodePath returns the Node.js executable: the --node flag, $DJS_NODE, or
+// node from the PATH.
+func nodePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(nodeEnv); env != "" {
+		return env
+	}
+	return "node"
+}
+
+// nodeVersion is a Node.js version. Versions given by people, such as "16",
+// may omit the minor and patch numbers.
+type nodeVersion struct {
+	major, minor, patch int
+}
+
+func parseNodeVersion(s string) (nodeVersion, error) {
+	var v nodeVersion
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(s), "v"), ".", 3)
+	fields := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		// pre-release versions, like 22.0.0-nightly, count as the release
+		part, _, _ = strings.Cut(part, "-")
+		if _, err := fmt.Sscanf(part, "%d", fields[i]); err != nil {
+			return nodeVersion{}, fmt.Errorf("invalid Node.js version %q", s)
+		}
+	}
+	return v, nil
+}
+
+func (v nodeVersion) less(w nodeVersion) bool {
+	if v.major != w.major {
+		return v.major < w.major
+	}
+	if v.minor != w.minor {
+		return v.minor < w.minor
+	}
+	return v.patch < w.patch
+}
+
+func (v nodeVersion) String() string {
+	if v.patch != 0 {
+		return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	}
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// nodeRequirement is a feature that needs a version of Node.js. Features
+// backported to older release lines have a version per line: the last one
+// applies to later lines too, the others to their own line only.
+type nodeRequirement struct {
+	feature  string
+	versions []nodeVersion
+}
+
+func (r nodeRequirement) satisfiedBy(v nodeVersion) bool {
+	for i, min := range r.versions {
+		if i == len(r.versions)-1 {
+			return !v.less(min)
+		}
+		if v.major == min.major && !v.less(min) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r nodeRequirement) String() string {
+	names := make([]string, len(r.versions))
+	for i, v := range r.versions {
+		names[i] = v.String()
+	}
+	return fmt.Sprintf("%s requires Node.js %s or later", r.feature, strings.Join(names, ", "))
+}
+
+// nodeRequirements returns the features djs uses to run a program, with the
+// versions of Node.js they need. The features of the program itself are
+// checked once it is parsed. ES modules need the module.register() API
+// for the loader. A minimum version set by the user applies too, if it isn't
+// zero.
+func nodeRequirements(esmLoader bool, minimum nodeVersion) []nodeRequirement {
+	reqs := []nodeRequirement{
+		{"async/await", []nodeVersion{{major: 7, minor: 6}}},
+		{"--enable-source-maps", []nodeVersion{{major: 12, minor: 12}}},
+	}
+	if esmLoader {
+		reqs = append(reqs, nodeRequirement{"running ES modules (or transpile them with -o)", []nodeVersion{{major: 18, minor: 19}, {major: 20, minor: 6}}})
+	}
+	if minimum != (nodeVersion{}) {
+		reqs = append(reqs, nodeRequirement{"--min-node-version", []nodeVersion{minimum}})
+	}
+	return reqs
+}
+
+// featureVersions are the versions of Node.js that parse the features of
+// compiled programs.
+var featureVersions = map[plugins.Feature][]nodeVersion{
+	plugins.OptionalChaining:  {{major: 14}},
+	plugins.NullishCoalescing: {{major: 14}},
+	plugins.LogicalAssignment: {{major: 15}},
+	plugins.TopLevelAwait:     {{major: 14, minor: 8}},
+}
+
+// featureRequirements returns the requirements of the features a program
+// uses, as found by plugins.ProgramFeatures.
+func featureRequirements(features []plugins.Feature) []nodeRequirement {
+	var reqs []nodeRequirement
+	for _, f := range features {
+		if versions, ok := featureVersions[f]; ok {
+			reqs = append(reqs, nodeRequirement{string(f), versions})
+		}
+	}
+	return reqs
+}
+
+// findNodeVersion runs node and returns its version.
+func findNodeVersion(node string) (nodeVersion, error) {
+	cmd := exec.Command(node, "--version")
+	output, err := cmd.Output()
+	if err != nil {
+		return nodeVersion{}, fmt.Errorf("%s command not found or failed to execute", node)
+	}
+
+	version, err := parseNodeVersion(string(output))
+	if err != nil {
+		return nodeVersion{}, fmt.Errorf("unable to parse node version: %s", strings.TrimSpace(string(output)))
+	}
+	return version, nil
+}
+
+// supports reports whether node parses the features that a program uses,
+// and prints the requirement it doesn't meet.
+func (node nodeOptions) supports(features []plugins.Feature) bool {
+	if err := checkNodeVersion(node.Version, featureRequirements(features)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// checkNodeVersion checks that a version of node has the features that are
+// required.
+func checkNodeVersion(version nodeVersion, reqs []nodeRequirement) error {
+	for _, req := range reqs {
+		if !req.satisfiedBy(version) {
+			return fmt.Errorf("node version %d.%d.%d is too old; %s", version.major, version.minor, version.patch, req)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"strconv"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// AssertStatement represents `assert condition` or `assert condition, message`
+type AssertStatement struct {
+	Token     token.Token    // the 'assert' token
+	Condition ast.Expression // the asserted condition
+	Message   ast.Expression // the error message (can be nil)
+	strip     bool           // true when assertions are removed from the output
+}
+
+func (as *AssertStatement) WriteTo(cw *ast.CodeWriter) {
+	if as.strip {
+		cw.WriteRune(';')
+		return
+	}
+	cw.AddMapping(as.Token.Start)
+	cw.WriteString("if(!(")
+	as.Condition.WriteTo(cw)
+	cw.WriteString(")){")
+	// the error is created at the position of the 'assert' keyword, so its
+	// stack trace points at the original line through source maps
+	cw.AddMapping(as.Token.Start)
+	cw.WriteString("throw Object.assign(new Error(")
+	if as.Message != nil {
+		as.Message.WriteTo(cw)
+	} else {
+		var condition ast.CodeWriter
+		as.Condition.WriteTo(&condition)
+		cw.WriteString(strconv.Quote("assertion failed: " + condition.String()))
+	}
+	cw.WriteString(`),{name:"AssertionError"})}`)
+}
+
+// AssertPlugin adds the `assert` statement, which throws an AssertionError
+// when its condition is false:
+//
+//	assert retries >= 0, "retries must not be negative"
+//
+// `assert(...)` and `assert.equal(...)` are still calls, so Node's assert
+// module keeps working.
+func AssertPlugin(pb *parser.Builder) {
+	installAssert(pb, false)
+}
+
+// StripAssertsPlugin is like AssertPlugin, but assertions are removed from
+// the output, and their conditions are not evaluated.
+func StripAssertsPlugin(pb *parser.Builder) {
+	installAssert(pb, true)
+}
+
+func installAssert(pb *parser.Builder, strip bool) {
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if !isIdent(p.CurrentToken, "assert") || p.PeekToken.AfterNewline || !startsAssertion(p.PeekToken) {
+			return next()
+		}
+		stmt := &AssertStatement{Token: p.CurrentToken, strip: strip}
+		p.NextToken() // move to the condition
+		stmt.Condition = p.ParseExpression()
+		if stmt.Condition == nil {
+			return nil
+		}
+		if p.PeekToken.Type == token.COMMA {
+			p.NextToken() // consume ','
+			p.NextToken() // move to the message
+			stmt.Message = p.ParseExpression()
+			if stmt.Message == nil {
+				return nil
+			}
+		}
+		p.ExpectSemicolonASI()
+		return stmt
+	})
+}
+
+// startsAssertion reports whether the token after `assert` starts the
+// condition of an assert statement, rather than continuing an expression
+// that uses a variable named assert.
+func startsAssertion(tok token.Token) bool {
+	switch tok.Type {
+	case token.INT, token.FLOAT, token.STRING, token.RAW_STRING, token.NOT:
+		return true
+	}
+	if tok.Literal == "" || tok.Literal == "in" || tok.Literal == "instanceof" || tok.Literal == "or" {
+		return false
+	}
+	ch := tok.Literal[0]
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
@@ -0,0 +1,105 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestAssertStatement(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "assert with message",
+			input:    `assert b != 0, "division by zero"`,
+			expected: `if(!((b!==0))){throw Object.assign(new Error("division by zero"),{name:"AssertionError"})}`,
+		},
+		{
+			name:     "assert without message",
+			input:    `assert ready`,
+			expected: `if(!(ready)){throw Object.assign(new Error("assertion failed: ready"),{name:"AssertionError"})}`,
+		},
+		{
+			name:     "negated condition",
+			input:    `assert !closed, "closed: " + name`,
+			expected: `if(!((!closed))){throw Object.assign(new Error(("closed: "+name)),{name:"AssertionError"})}`,
+		},
+		{
+			name:     "assert module calls are unchanged",
+			input:    "assert(ok)\nassert.equal(a, b)\nlet assert = require(\"assert\")",
+			expected: `assert(ok);assert.equal(a,b);let assert=require("assert")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(StrictEqualityPlugin).
+				Install(AssertPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestStripAsserts(t *testing.T) {
+	input := "function div(a, b) {\n assert b != 0, \"division by zero\"\n return a / b\n}\nif (debug) assert check()"
+	expected := `function div(a,b){;;return (a/b)};if (debug);`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		WithSmartSemicolon(true).
+		Install(StripAssertsPlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	if result.Code != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result.Code)
+	}
+}
+
+func TestAssertErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "missing message after comma",
+			input: `assert ok,`,
+		},
+		{
+			name:  "two statements on one line",
+			input: `assert ok foo()`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(AssertPlugin).
+				Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
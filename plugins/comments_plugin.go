@@ -0,0 +1,126 @@
+package plugins
+
+import (
+	"strings"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// CommentedStatement is a statement preceded by a preserved comment, such as
+// a license header or a JSDoc block.
+type CommentedStatement struct {
+	Comment   token.Token // the comment token, including its /* */ delimiters
+	Statement ast.Statement
+}
+
+func (cs *CommentedStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(cs.Comment.Start)
+	cw.WriteString(cs.Comment.Literal)
+	cw.WriteRune('\n')
+	if cs.Statement != nil {
+		cs.Statement.WriteTo(cw)
+	}
+}
+
+// CommentsPlugin adds multi-line comments (`/* ... */`), which are dropped from
+// the output.
+func CommentsPlugin(pb *parser.Builder) {
+	installComments(pb, false)
+}
+
+// PreserveCommentsPlugin is like CommentsPlugin, but license headers (`/*!`,
+// `@license`, `@preserve`) and JSDoc blocks (`/** ... */`) that start a line
+// are kept in the output, attached to the statement that follows them.
+func PreserveCommentsPlugin(pb *parser.Builder) {
+	installComments(pb, true)
+}
+
+func installComments(pb *parser.Builder, preserve bool) {
+	lb := pb.LexerBuilder
+	commentTokenType := lb.RegisterTokenType("COMMENT")
+
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		if ret.Type != token.DIVIDE || l.CurrentChar != '*' {
+			return ret
+		}
+
+		var text strings.Builder
+		text.WriteString("/*")
+		hadNewline := false
+		l.ReadChar() // consume '*'
+		for {
+			if l.CurrentChar == 0 {
+				ret.Type = token.ILLEGAL
+				ret.Literal = "unterminated comment"
+				return ret
+			}
+			if l.CurrentChar == '*' && l.PeekChar() == '/' {
+				l.ReadChar() // consume '*'
+				l.ReadChar() // consume '/'
+				text.WriteString("*/")
+				break
+			}
+			if l.CurrentChar == '\n' {
+				hadNewline = true
+			}
+			text.WriteByte(l.CurrentChar)
+			l.ReadChar()
+		}
+
+		// only comments on their own line (or at the very beginning of the
+		// input) are kept, so they never appear in the middle of an expression
+		comment := text.String()
+		startsLine := ret.AfterNewline || (ret.Start.Line == 1 && ret.Start.Column <= 1)
+		if preserve && startsLine && isPreservedComment(comment) {
+			ret.Type = commentTokenType
+			ret.Literal = comment
+			return ret
+		}
+
+		tok := l.NextToken()
+		tok.AfterNewline = tok.AfterNewline || ret.AfterNewline || hadNewline
+		return tok
+	})
+
+	if !preserve {
+		return
+	}
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != commentTokenType {
+			return next()
+		}
+		stmt := &CommentedStatement{Comment: p.CurrentToken}
+		// a comment at the end of a block or file has no statement to attach to
+		if p.PeekToken.Type == token.RBRACE || p.PeekToken.Type == token.EOF {
+			return stmt
+		}
+		p.NextToken() // move to the commented statement
+		stmt.Statement = p.ParseStatement()
+		if stmt.Statement == nil {
+			return nil
+		}
+		return stmt
+	})
+
+	// comments before object properties or array elements are skipped
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		for p.CurrentToken.Type == commentTokenType {
+			p.NextToken()
+		}
+		return next()
+	})
+}
+
+// isPreservedComment reports whether a block comment is a license header or
+// a JSDoc block.
+func isPreservedComment(comment string) bool {
+	if strings.HasPrefix(comment, "/*!") || strings.Contains(comment, "@license") || strings.Contains(comment, "@preserve") {
+		return true
+	}
+	return strings.HasPrefix(comment, "/**") && comment != "/**/"
+}
@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestBlockComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "inline comment",
+			input:    `let x = /* answer */ 42`,
+			expected: `let x=42`,
+		},
+		{
+			name: "multi-line comment",
+			input: `/*
+			 * setup
+			 */
+			let x = 1`,
+			expected: `let x=1`,
+		},
+		{
+			name:     "comment between arguments",
+			input:    `console.log(1, /* two */ 2)`,
+			expected: `console.log(1,2)`,
+		},
+		{
+			name:     "asterisks inside comment",
+			input:    `let x = 2 /** * **/ * 3`,
+			expected: `let x=(2*3)`,
+		},
+		{
+			name:     "empty comment",
+			input:    `let x = 1 /**/ / 2`,
+			expected: `let x=(1/2)`,
+		},
+		{
+			name: "multi-line comment ends a statement",
+			input: `let x = 1 /* first
+			*/ let y = 2`,
+			expected: `let x=1;let y=2`,
+		},
+		{
+			name:     "JSDoc is dropped by default",
+			input:    "/** Adds numbers. */\nfunction add(a, b) { return a + b }",
+			expected: `function add(a,b){return (a+b)}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(CommentsPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestPreserveComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "license header",
+			input:    "/*! MIT License */\nlet x = 1",
+			expected: "/*! MIT License */\nlet x=1",
+		},
+		{
+			name:     "license annotation",
+			input:    "/*\n * @license Apache-2.0\n */\nlet x = 1",
+			expected: "/*\n * @license Apache-2.0\n */\nlet x=1",
+		},
+		{
+			name:     "JSDoc on a function",
+			input:    "let x = 1\n/**\n * Adds numbers.\n * @param {number} a\n */\nfunction add(a, b) { return a + b }",
+			expected: "let x=1;/**\n * Adds numbers.\n * @param {number} a\n */\nfunction add(a,b){return (a+b)}",
+		},
+		{
+			name:     "JSDoc inside a block",
+			input:    "function f() {\n  /** @type {number} */\n  let x = 1\n  return x\n}",
+			expected: "function f(){/** @type {number} */\nlet x=1;return x}",
+		},
+		{
+			name:     "plain comments are dropped",
+			input:    "/* internal note */\nlet x = 1",
+			expected: "let x=1",
+		},
+		{
+			name:     "JSDoc in the middle of a line is dropped",
+			input:    "let x = /** @type {number} */ (y)",
+			expected: "let x=(y)",
+		},
+		{
+			name:     "JSDoc on an object property is dropped",
+			input:    "let config = {\n  /** Port to listen on. */\n  port: 3000\n}",
+			expected: "let config={port:3000}",
+		},
+		{
+			name:     "trailing comment",
+			input:    "let x = 1\n/** @todo */",
+			expected: "let x=1;/** @todo */\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(PreserveCommentsPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		Install(CommentsPlugin).
+		Build("let x = 1\n/* never closed")
+	_, err := p.ParseProgram()
+	if err == nil {
+		t.Error("Expected error for unterminated comment, but got none")
+	}
+}
@@ -0,0 +1,413 @@
+package plugins
+
+import (
+	"sync"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// DoWhileStatement represents `do body while (condition)`
+type DoWhileStatement struct {
+	Token     token.Token // the 'do' token
+	Body      ast.Statement
+	Condition ast.Expression
+}
+
+func (ds *DoWhileStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ds.Token.Start)
+	cw.WriteString("do ")
+	ds.Body.WriteTo(cw)
+	cw.WriteString("while (")
+	ds.Condition.WriteTo(cw)
+	cw.WriteRune(')')
+}
+
+// LabeledStatement represents `label: statement`, the target of labeled
+// `break` and `continue` statements.
+type LabeledStatement struct {
+	Label *ast.Identifier
+	Body  ast.Statement
+}
+
+func (ls *LabeledStatement) WriteTo(cw *ast.CodeWriter) {
+	ls.Label.WriteTo(cw)
+	cw.WriteRune(':')
+	ls.Body.WriteTo(cw)
+}
+
+// BranchStatement represents `break` or `continue`, with an optional label.
+type BranchStatement struct {
+	Token token.Token     // the 'break' or 'continue' token
+	Label *ast.Identifier // can be nil
+}
+
+func (bs *BranchStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(bs.Token.Start)
+	cw.WriteString(bs.Token.Literal)
+	if bs.Label != nil {
+		cw.WriteRune(' ')
+		bs.Label.WriteTo(cw)
+	}
+}
+
+// SwitchCase is a `case test:` clause, or the `default:` clause when Test is
+// nil. Without a `break`, execution falls through to the next clause.
+type SwitchCase struct {
+	Token      token.Token    // the 'case' or 'default' token
+	Test       ast.Expression // nil for default
+	Consequent []ast.Statement
+}
+
+// SwitchStatement represents `switch (discriminant) { case ...: ... }`
+type SwitchStatement struct {
+	Token        token.Token // the 'switch' token
+	Discriminant ast.Expression
+	Cases        []*SwitchCase
+}
+
+func (ss *SwitchStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ss.Token.Start)
+	cw.WriteString("switch (")
+	ss.Discriminant.WriteTo(cw)
+	cw.WriteString("){")
+	for _, c := range ss.Cases {
+		cw.AddMapping(c.Token.Start)
+		if c.Test != nil {
+			cw.WriteString("case ")
+			c.Test.WriteTo(cw)
+		} else {
+			cw.WriteString("default")
+		}
+		cw.WriteRune(':')
+		for _, stmt := range c.Consequent {
+			stmt.WriteTo(cw)
+			cw.WriteRune(';')
+		}
+	}
+	cw.WriteRune('}')
+}
+
+// ForInStatement represents `for (let key in object) body`
+type ForInStatement struct {
+	Token  token.Token // the 'for' token
+	Name   *ast.Identifier
+	Object ast.Expression
+	Body   ast.Statement
+	Assign bool // true for `for (key in object)`, which assigns an existing variable
+}
+
+func (fs *ForInStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(fs.Token.Start)
+	cw.WriteString("for(")
+	if !fs.Assign {
+		cw.WriteString("let ")
+	}
+	fs.Name.WriteTo(cw)
+	cw.WriteString(" in ")
+	fs.Object.WriteTo(cw)
+	cw.WriteRune(')')
+	fs.Body.WriteTo(cw)
+}
+
+// SequenceExpression represents the comma operator: `a, b`. It is accepted in
+// parentheses and in the clauses of `for` loops.
+type SequenceExpression struct {
+	Expressions []ast.Expression
+}
+
+func (se *SequenceExpression) WriteTo(cw *ast.CodeWriter) {
+	for i, exp := range se.Expressions {
+		if i > 0 {
+			cw.WriteRune(',')
+		}
+		exp.WriteTo(cw)
+	}
+}
+
+// CompatPlugin fills in the JavaScript statements and operators that the
+// base grammar leaves out, so existing scripts can be ported as is:
+// `do...while`, labeled statements, `break` and `continue` (optionally
+// labeled), `switch` with fall-through, `for...in` and `for...of` loops,
+// the comma operator, and the `void`, `typeof`, `delete`, `in` and
+// `instanceof` operators.
+func CompatPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	inToken := lb.RegisterTokenType("IN")
+	instanceofToken := lb.RegisterTokenType("INSTANCEOF")
+	optionalTokenType := lb.RegisterTokenType("?.")
+	keywords := map[string]token.Type{
+		"in":         inToken,
+		"instanceof": instanceofToken,
+		"void":       lb.RegisterTokenType("VOID"),
+		"typeof":     lb.RegisterTokenType("TYPEOF"),
+		"delete":     lb.RegisterTokenType("DELETE"),
+	}
+
+	// whether the last token of each lexer starts a property name, so that
+	// `map.delete(key)` and `obj?.in` keep working
+	var afterDot sync.Map
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		prev, _ := afterDot.Load(l)
+		if ret.Type == token.EOF {
+			afterDot.Delete(l)
+		} else {
+			// `?.` may be completed by an outer interceptor after this one
+			optional := ret.Type == token.ILLEGAL && ret.Literal == "?" && l.CurrentChar == '.'
+			afterDot.Store(l, ret.Type == token.DOT || ret.Type == optionalTokenType || optional)
+		}
+		if ret.Type != token.IDENT || prev == true {
+			return ret
+		}
+		if tokenType, ok := keywords[ret.Literal]; ok {
+			ret.Type = tokenType
+		}
+		return ret
+	})
+
+	// the keywords are still valid property names in object literals
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if tokenType, ok := keywords[p.CurrentToken.Literal]; !ok || p.CurrentToken.Type != tokenType || p.PeekToken.Type != token.COLON {
+			return next()
+		}
+		return &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+	})
+
+	for _, tokenType := range []token.Type{inToken, instanceofToken} {
+		_ = pb.RegisterInfixOperator(tokenType, parser.COMPARISON, func(tok token.Token, left ast.Expression, right func() ast.Expression) ast.Expression {
+			return &ast.BinaryExpression{
+				Token:    tok,
+				Left:     left,
+				Operator: " " + tok.Literal + " ",
+				Right:    right(),
+			}
+		})
+	}
+	for _, name := range []string{"void", "typeof", "delete"} {
+		_ = pb.RegisterPrefixOperator(keywords[name], func(tok token.Token, right func() ast.Expression) ast.Expression {
+			return &ast.UnaryExpression{
+				Token:    tok,
+				Operator: tok.Literal + " ",
+				Right:    right(),
+			}
+		})
+	}
+
+	// comma expressions in parentheses: `(a, b)`
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != token.LPAREN {
+			return next()
+		}
+		exp := &ast.GroupedExpression{Token: p.CurrentToken}
+		p.NextToken() // consume (
+		exp.Expression = parseSequence(p)
+		if !p.ExpectToken(token.RPAREN) {
+			return nil
+		}
+		return p.ParseRemainingExpression(exp)
+	})
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != token.FOR || p.PeekToken.Type != token.LPAREN {
+			return next()
+		}
+		return parseForStatement(p, inToken)
+	})
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		tok := p.CurrentToken
+		switch {
+		case isIdent(tok, "do"):
+			return parseDoWhileStatement(p)
+		case isIdent(tok, "switch") && p.PeekToken.Type == token.LPAREN:
+			return parseSwitchStatement(p)
+		case isIdent(tok, "break"), isIdent(tok, "continue"):
+			stmt := &BranchStatement{Token: tok}
+			if p.PeekToken.Type == token.IDENT && !p.PeekToken.AfterNewline {
+				p.NextToken() // move to the label
+				stmt.Label = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			}
+			if !p.ExpectSemicolonASI() {
+				return nil
+			}
+			return stmt
+		case tok.Type == token.IDENT && p.PeekToken.Type == token.COLON:
+			stmt := &LabeledStatement{Label: &ast.Identifier{Token: tok, Value: tok.Literal}}
+			p.NextToken() // consume ':'
+			p.NextToken() // move to the statement
+			stmt.Body = p.ParseStatement()
+			if stmt.Body == nil {
+				return nil
+			}
+			return stmt
+		}
+		return next()
+	})
+}
+
+// parseSequence parses one or more comma-separated expressions.
+func parseSequence(p *parser.Parser) ast.Expression {
+	exp := p.ParseExpression()
+	if p.PeekToken.Type != token.COMMA {
+		return exp
+	}
+	seq := &SequenceExpression{Expressions: []ast.Expression{exp}}
+	for p.PeekToken.Type == token.COMMA {
+		p.NextToken() // consume ','
+		p.NextToken() // move to the next expression
+		seq.Expressions = append(seq.Expressions, p.ParseExpression())
+	}
+	return seq
+}
+
+func parseDoWhileStatement(p *parser.Parser) ast.Statement {
+	stmt := &DoWhileStatement{Token: p.CurrentToken}
+	p.NextToken() // move to the body
+	stmt.Body = p.ParseStatement()
+	if stmt.Body == nil {
+		return nil
+	}
+	if !p.ExpectToken(token.WHILE) || !p.ExpectToken(token.LPAREN) {
+		return nil
+	}
+	p.NextToken() // move to the condition
+	stmt.Condition = p.ParseExpression()
+	if !p.ExpectToken(token.RPAREN) {
+		return nil
+	}
+	if p.PeekToken.Type == token.SEMICOLON {
+		p.NextToken()
+	}
+	return stmt
+}
+
+func parseSwitchStatement(p *parser.Parser) ast.Statement {
+	stmt := &SwitchStatement{Token: p.CurrentToken}
+	p.NextToken() // consume 'switch'
+	p.NextToken() // consume (
+	stmt.Discriminant = p.ParseExpression()
+	if !p.ExpectToken(token.RPAREN) || !p.ExpectToken(token.LBRACE) {
+		return nil
+	}
+	p.PushContext(parser.BlockContext)
+	defer p.PopContext()
+	p.NextToken() // consume {
+
+	isClause := func() bool {
+		return isIdent(p.CurrentToken, "case") || (isIdent(p.CurrentToken, "default") && p.PeekToken.Type == token.COLON)
+	}
+	for p.CurrentToken.Type != token.RBRACE {
+		if !isClause() {
+			p.AddErrorAtToken("expected case or default in switch statement", p.CurrentToken)
+			return nil
+		}
+		clause := &SwitchCase{Token: p.CurrentToken}
+		if isIdent(p.CurrentToken, "case") {
+			p.NextToken() // move to the test
+			clause.Test = p.ParseExpression()
+		}
+		if !p.ExpectToken(token.COLON) {
+			return nil
+		}
+		p.NextToken() // consume ':'
+		for p.CurrentToken.Type != token.RBRACE && p.CurrentToken.Type != token.EOF && !isClause() {
+			if s := p.ParseStatement(); s != nil {
+				clause.Consequent = append(clause.Consequent, s)
+			}
+			p.NextToken()
+		}
+		stmt.Cases = append(stmt.Cases, clause)
+		if p.CurrentToken.Type == token.EOF {
+			p.AddError("unterminated switch statement")
+			return nil
+		}
+	}
+	return stmt
+}
+
+// parseForStatement parses `for...of` and `for...in` loops and, since the
+// `of` or `in` is only found after the loop variable, regular `for` loops too.
+func parseForStatement(p *parser.Parser, inToken token.Type) ast.Statement {
+	forTok := p.CurrentToken
+	p.NextToken() // consume 'for'
+	stmt := &ast.ForStatement{Token: forTok}
+
+	// the loop variable, either declared (`let x`) or existing (`x`)
+	var name *ast.Identifier
+	assign := false
+	switch p.PeekToken.Type {
+	case token.SEMICOLON:
+		p.NextToken() // consume semicolon
+	case token.LET:
+		p.NextToken() // move to 'let'
+		init := &ast.LetStatement{Token: p.CurrentToken}
+		if !p.ExpectToken(token.IDENT) {
+			return nil
+		}
+		init.Name = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		name = init.Name
+		if isIdent(p.PeekToken, "of") || p.PeekToken.Type == inToken {
+			break
+		}
+		if p.PeekToken.Type == token.ASSIGN {
+			p.NextToken() // consume =
+			p.NextToken() // move to value
+			init.Value = p.ParseExpression()
+		}
+		if !p.ExpectToken(token.SEMICOLON) {
+			return nil
+		}
+		stmt.Init = init
+	default:
+		p.NextToken()
+		if p.CurrentToken.Type == token.IDENT && (isIdent(p.PeekToken, "of") || p.PeekToken.Type == inToken) {
+			name = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			assign = true
+			break
+		}
+		stmt.Init = &ast.ExpressionStatement{Token: p.CurrentToken, Expression: parseSequence(p)}
+		if !p.ExpectToken(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if stmt.Init == nil && name != nil {
+		in := p.PeekToken.Type == inToken
+		p.NextToken() // consume 'of' or 'in'
+		p.NextToken() // move to the iterable
+		iterable := p.ParseExpression()
+		if !p.ExpectToken(token.RPAREN) {
+			return nil
+		}
+		p.NextToken() // move to the body
+		body := p.ParseStatement()
+		if body == nil {
+			return nil
+		}
+		if in {
+			return &ForInStatement{Token: forTok, Name: name, Object: iterable, Body: body, Assign: assign}
+		}
+		return &ForOfStatement{Token: forTok, Name: name, Iterable: iterable, Body: body, Assign: assign}
+	}
+
+	if p.PeekToken.Type != token.SEMICOLON {
+		p.NextToken()
+		stmt.Condition = p.ParseExpression()
+	}
+	if !p.ExpectToken(token.SEMICOLON) {
+		return nil
+	}
+	if p.PeekToken.Type != token.RPAREN {
+		p.NextToken()
+		stmt.Update = parseSequence(p)
+	}
+	if !p.ExpectToken(token.RPAREN) {
+		return nil
+	}
+	p.NextToken()
+	stmt.Body = p.ParseStatement()
+	return stmt
+}
@@ -0,0 +1,182 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestCompatStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "do while",
+			input:    "do {\n i = i + 1\n} while (i < 3)",
+			expected: `do {i=(i+1)}while ((i<3))`,
+		},
+		{
+			name:     "labeled break and continue",
+			input:    "outer: while (true) {\n while (true) {\n  continue outer\n  break outer\n }\n break\n}",
+			expected: `outer:while (true){while (true){continue outer;break outer};break}`,
+		},
+		{
+			name:     "break before a line break has no label",
+			input:    "while (true) {\n break\n done()\n}",
+			expected: `while (true){break;done()}`,
+		},
+		{
+			name:     "switch with fall-through",
+			input:    "switch (x) {\n case 1:\n case 2:\n  one()\n  break\n default:\n  other()\n}",
+			expected: `switch (x){case 1:case 2:one();break;default:other();}`,
+		},
+		{
+			name:     "switch with block clause",
+			input:    `switch (cmd) { case "a": { run() } }`,
+			expected: `switch (cmd){case "a":{run()};}`,
+		},
+		{
+			name:     "for in",
+			input:    `for (let key in obj) { console.log(key) }`,
+			expected: `for(let key in obj){console.log(key)}`,
+		},
+		{
+			name:     "for in with an existing variable",
+			input:    `for (key in obj) {}`,
+			expected: `for(key in obj){}`,
+		},
+		{
+			name:     "for of with an existing variable",
+			input:    `for (item of list) {}`,
+			expected: `for(item of list){}`,
+		},
+		{
+			name:     "comma in for clauses",
+			input:    `for (i = 0, j = 9; i < j; i++, j--) {}`,
+			expected: `for (i=0,j=9;(i<j);(i++),(j--)){}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(CompatPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestCompatOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "typeof",
+			input:    `let t = typeof x == "string"`,
+			expected: `let t=((typeof x)==="string")`,
+		},
+		{
+			name:     "void",
+			input:    `let u = void 0`,
+			expected: `let u=(void 0)`,
+		},
+		{
+			name:     "delete",
+			input:    `delete cache[key]`,
+			expected: `(delete cache[key])`,
+		},
+		{
+			name:     "in",
+			input:    `let has = "a" in obj && ok`,
+			expected: `let has=(("a" in obj)&&ok)`,
+		},
+		{
+			name:     "instanceof",
+			input:    `let isErr = err instanceof Error`,
+			expected: `let isErr=(err instanceof Error)`,
+		},
+		{
+			name:     "comma in parentheses",
+			input:    `let last = (a(), b())`,
+			expected: `let last=(a(),b())`,
+		},
+		{
+			name:     "keywords as property names",
+			input:    `map.delete(key); let o = { delete: 1, in: 2 }; o.typeof = o.in`,
+			expected: `map.delete(key);let o={delete:1,in:2};o.typeof=o.in`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(StrictEqualityPlugin).
+				Install(CompatPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestCompatErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "do without while",
+			input: `do { run() } until (done)`,
+		},
+		{
+			name:  "switch without clauses",
+			input: `switch (x) { run() }`,
+		},
+		{
+			name:  "unterminated switch",
+			input: `switch (x) { case 1: run()`,
+		},
+		{
+			name:  "for in without object",
+			input: `for (let k in) {}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(CompatPlugin).
+				Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
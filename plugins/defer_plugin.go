@@ -1,7 +1,8 @@
 package plugins
 
 import (
-	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/rs/xid"
 	"github.com/xjslang/xjs/ast"
@@ -10,43 +11,76 @@ import (
 	"github.com/xjslang/xjs/token"
 )
 
-// writeFunctionWithDefers writes a function with defer support
-func writeFunctionWithDefers(cw *ast.CodeWriter, name *ast.Identifier, parameters []*ast.Identifier, body *ast.BlockStatement, prefix string) {
-	cw.WriteString("function")
+// writeFunctionWithDefers writes a function with defer support. Async
+// functions await each deferred call, so cleanup can be asynchronous too.
+func writeFunctionWithDefers(cw *ast.CodeWriter, tok token.Token, name *ast.Identifier, parameters []*ast.Identifier, body *ast.BlockStatement, prefix string, asyncFn bool) {
+	if asyncFn {
+		cw.WriteString("async ")
+	}
+	// the generator plugin lexes `function*` as a single token
+	cw.WriteString(tok.Literal)
 	if name != nil {
 		cw.WriteRune(' ')
 		name.WriteTo(cw)
 	}
 	cw.WriteRune('(')
+	writeParameters(cw, parameters)
+
+	temps := scopeTemps(body)
+	if hasDefers, awaitDefers := functionDefers(body, asyncFn); hasDefers {
+		cw.WriteString(") {")
+		writeTemps(cw, temps)
+		writeDeferredBody(cw, prefix, awaitDefers, func() { body.WriteTo(cw) })
+		cw.WriteRune('}')
+	} else if len(temps) > 0 {
+		cw.WriteString("){")
+		writeTemps(cw, temps)
+		writeStatements(cw, body.Statements)
+		cw.WriteRune('}')
+	} else {
+		cw.WriteRune(')')
+		body.WriteTo(cw)
+	}
+}
+
+func writeParameters(cw *ast.CodeWriter, parameters []*ast.Identifier) {
 	for i, param := range parameters {
 		if i > 0 {
 			cw.WriteRune(',')
 		}
 		param.WriteTo(cw)
 	}
+}
 
-	var hasDefers bool
-	for _, stmt := range body.Statements {
-		if _, ok := stmt.(*DeferStatement); ok {
-			hasDefers = true
-			break
+// functionDefers reports whether a function body pushes onto the defer stack,
+// and whether the deferred calls must be awaited.
+func functionDefers(body *ast.BlockStatement, asyncFn bool) (hasDefers, awaitDefers bool) {
+	for _, stmt := range deferredStatements(body.Statements) {
+		hasDefers = true
+		if us, ok := stmt.(*UseStatement); ok {
+			awaitDefers = awaitDefers || us.Await
 		}
 	}
+	return hasDefers, hasDefers && (asyncFn || awaitDefers)
+}
 
-	if hasDefers {
-		deferName := "defers_" + prefix
-		indexName := "i_" + prefix
-		errorName := "e_" + prefix
-		cw.WriteString(") {let " + deferName + "=[];try")
-		body.WriteTo(cw)
-		cw.WriteString("finally{" +
-			"for(let " + indexName + "=" + deferName + ".length;" + indexName + ">0;" + indexName + "--){" +
-			"try{" + deferName + "[" + indexName + "-1]()}catch(" + errorName + "){console.log(" + errorName + ")}}}}",
-		)
-	} else {
-		cw.WriteRune(')')
-		body.WriteTo(cw)
+// writeDeferredBody declares the defer stack, writes the body (a block) in a
+// try statement and runs the deferred functions in reverse order afterwards.
+func writeDeferredBody(cw *ast.CodeWriter, prefix string, awaitDefers bool, writeBlock func()) {
+	deferName := "defers_" + prefix
+	indexName := "i_" + prefix
+	errorName := "e_" + prefix
+	// async resources are disposed sequentially, awaiting each cleanup
+	callPrefix := ""
+	if awaitDefers {
+		callPrefix = "await "
 	}
+	cw.WriteString("let " + deferName + "=[];try")
+	writeBlock()
+	cw.WriteString("finally{" +
+		"for(let " + indexName + "=" + deferName + ".length;" + indexName + ">0;" + indexName + "--){" +
+		"try{" + callPrefix + deferName + "[" + indexName + "-1]()}catch(" + errorName + "){console.log(" + errorName + ")}}}",
+	)
 }
 
 type DeferFunctionDeclaration struct {
@@ -56,10 +90,7 @@ type DeferFunctionDeclaration struct {
 }
 
 func (fd *DeferFunctionDeclaration) WriteTo(cw *ast.CodeWriter) {
-	if fd.asyncFn {
-		cw.WriteString("async ")
-	}
-	writeFunctionWithDefers(cw, fd.Name, fd.Parameters, fd.Body, fd.prefix)
+	writeFunctionWithDefers(cw, fd.Token, fd.Name, fd.Parameters, fd.Body, fd.prefix, fd.asyncFn)
 }
 
 type DeferFunctionExpression struct {
@@ -69,27 +100,128 @@ type DeferFunctionExpression struct {
 }
 
 func (fe *DeferFunctionExpression) WriteTo(cw *ast.CodeWriter) {
-	if fe.asyncFn {
-		cw.WriteString("async ")
+	writeFunctionWithDefers(cw, fe.Token, fe.Name, fe.Parameters, fe.Body, fe.prefix, fe.asyncFn)
+}
+
+// AsyncArrowFunction represents `async x => expr` or `async (a, b) => { ... }`.
+// Arrow functions without `async` are not supported.
+type AsyncArrowFunction struct {
+	Token      token.Token // the 'async' token
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement // the block body, or nil
+	Expression ast.Expression      // the expression body, or nil
+	prefix     string
+}
+
+func (af *AsyncArrowFunction) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(af.Token.Start)
+	cw.WriteString("async (")
+	writeParameters(cw, af.Parameters)
+	cw.WriteString(") =>")
+	if af.Body == nil {
+		if temps := scopeTemps(af.Expression); len(temps) > 0 {
+			cw.WriteRune('{')
+			writeTemps(cw, temps)
+			cw.WriteString("return ")
+			af.Expression.WriteTo(cw)
+			cw.WriteRune('}')
+			return
+		}
+		af.Expression.WriteTo(cw)
+		return
+	}
+	temps := scopeTemps(af.Body)
+	if hasDefers, awaitDefers := functionDefers(af.Body, true); hasDefers {
+		cw.WriteRune('{')
+		writeTemps(cw, temps)
+		writeDeferredBody(cw, af.prefix, awaitDefers, func() { af.Body.WriteTo(cw) })
+		cw.WriteRune('}')
+	} else if len(temps) > 0 {
+		cw.WriteRune('{')
+		writeTemps(cw, temps)
+		writeStatements(cw, af.Body.Statements)
+		cw.WriteRune('}')
+	} else {
+		af.Body.WriteTo(cw)
 	}
-	writeFunctionWithDefers(cw, fe.Name, fe.Parameters, fe.Body, fe.prefix)
 }
 
 type DeferStatement struct {
 	Body   *ast.BlockStatement
 	prefix string
+	async  bool // true in async functions, so the body can use `await`
 }
 
 func (ds *DeferStatement) WriteTo(cw *ast.CodeWriter) {
 	deferName := "defers_" + ds.prefix
-	cw.WriteString(deferName + ".push(() =>")
+	cw.WriteString(deferName + ".push(")
+	if ds.async {
+		cw.WriteString("async ")
+	}
+	cw.WriteString("() =>")
 	ds.Body.WriteTo(cw)
 	cw.WriteRune(')')
 }
 
+// UseStatement represents a resource declaration (`use x = expr` or
+// `use await x = expr`). The resource is disposed through the defer stack
+// when the enclosing function exits.
+type UseStatement struct {
+	Token          token.Token // the 'use' token
+	Name           *ast.Identifier
+	Value          ast.Expression
+	Await          bool // true for `use await`, which prefers Symbol.asyncDispose
+	prefix         string
+	disposeMethods []string
+}
+
+func (us *UseStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(us.Token.Start)
+	cw.WriteString("let ")
+	us.Name.WriteTo(cw)
+	if oe, ok := us.Value.(*OrExpression); ok {
+		cw.WriteString(";try{")
+		us.Name.WriteTo(cw)
+		cw.WriteRune('=')
+		oe.Expression.WriteTo(cw)
+		cw.WriteString("}catch")
+		if oe.ErrorParam != nil {
+			cw.WriteRune('(')
+			oe.ErrorParam.WriteTo(cw)
+			cw.WriteRune(')')
+		}
+		oe.FallbackBlock.WriteTo(cw)
+	} else {
+		cw.WriteRune('=')
+		us.Value.WriteTo(cw)
+	}
+
+	// the resource may be null if an `or` fallback did not return
+	name := us.Name.Value
+	disposeName := "dispose_" + us.prefix
+	var lookup []string
+	if us.Await {
+		lookup = append(lookup, "(Symbol.asyncDispose&&"+name+"[Symbol.asyncDispose])")
+	}
+	lookup = append(lookup, "(Symbol.dispose&&"+name+"[Symbol.dispose])")
+	for _, method := range us.disposeMethods {
+		lookup = append(lookup, name+"."+method)
+	}
+	cw.WriteString(";defers_" + us.prefix + ".push(")
+	if us.Await {
+		cw.WriteString("async ")
+	}
+	cw.WriteString("() =>{if(" + name + "!=null){let " + disposeName + "=" + strings.Join(lookup, "||") + ";")
+	cw.WriteString("if(typeof " + disposeName + "!==\"function\"){throw new TypeError(\"" + name + " is not disposable\")}")
+	if us.Await {
+		cw.WriteString("await ")
+	}
+	cw.WriteString(disposeName + ".call(" + name + ")}})")
+}
+
 type AwaitExpression struct {
 	Token token.Token // the 'await' token
-	Right *ast.CallExpression
+	Right ast.Expression
 }
 
 func (ae *AwaitExpression) WriteTo(cw *ast.CodeWriter) {
@@ -98,14 +230,60 @@ func (ae *AwaitExpression) WriteTo(cw *ast.CodeWriter) {
 	ae.Right.WriteTo(cw)
 }
 
+// ForAwaitStatement represents `for await (let x of iterable) body`, which
+// iterates over async iterables such as Node.js readable streams.
+type ForAwaitStatement struct {
+	Token    token.Token // the 'for' token
+	Name     *ast.Identifier
+	Iterable ast.Expression
+	Body     ast.Statement
+}
+
+func (fs *ForAwaitStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(fs.Token.Start)
+	cw.WriteString("for await(let ")
+	fs.Name.WriteTo(cw)
+	cw.WriteString(" of ")
+	fs.Iterable.WriteTo(cw)
+	cw.WriteRune(')')
+	fs.Body.WriteTo(cw)
+}
+
+// DefaultDisposeMethods lists the methods tried, in order, to release a
+// resource declared with `use` that does not implement Symbol.dispose.
+var DefaultDisposeMethods = []string{"close", "end", "release", "destroy"}
+
+// DeferPlugin adds `defer`, `async`/`await` and `use` resource declarations.
 func DeferPlugin(pb *parser.Builder) {
+	installDefer(pb, DefaultDisposeMethods)
+}
+
+// DeferPluginWithDisposeMethods is like DeferPlugin, but `use` declarations
+// fall back to the given methods instead of DefaultDisposeMethods.
+func DeferPluginWithDisposeMethods(methods ...string) func(*parser.Builder) {
+	return func(pb *parser.Builder) {
+		installDefer(pb, methods)
+	}
+}
+
+func installDefer(pb *parser.Builder, disposeMethods []string) {
 	id := xid.New()
 	lb := pb.LexerBuilder
 	deferToken := lb.RegisterTokenType("DEFER")
 	asyncToken := lb.RegisterTokenType("ASYNC")
 	awaitToken := lb.RegisterTokenType("AWAIT")
+	arrowToken := useArrowToken(lb)
 
+	// the tokens read after an 'async', returned by the next calls
+	var pending sync.Map
 	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		if queued, ok := pending.LoadAndDelete(l); ok {
+			tokens := queued.([]token.Token)
+			if len(tokens) > 1 {
+				pending.Store(l, tokens[1:])
+			}
+			return tokens[0]
+		}
 		ret := next()
 		if ret.Type != token.IDENT {
 			return ret
@@ -115,63 +293,86 @@ func DeferPlugin(pb *parser.Builder) {
 			ret.Type = deferToken
 		case "async":
 			ret.Type = asyncToken
+			tokens := readAsyncMethod(l, ret)
+			// an 'async' read ahead may have left tokens of its own
+			if queued, ok := pending.Load(l); ok {
+				tokens = append(tokens, queued.([]token.Token)...)
+			}
+			pending.Store(l, tokens[1:])
+			return tokens[0]
 		case "await":
 			ret.Type = awaitToken
 		}
 		return ret
 	})
 
-	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
-		if p.CurrentToken.Type != awaitToken {
-			return next()
-		}
-
-		tok := p.CurrentToken
-		p.NextToken() // consume 'await'
-		exp := next()
-		fe, ok := exp.(*ast.CallExpression)
-		if !ok {
-			p.AddError(fmt.Sprintf("expected callable expression after await, got %v", p.PeekToken))
-			return nil
-		}
-		return &AwaitExpression{
-			Token: tok,
-			Right: fe,
+	// like other unary operators, `await` applies to the unary expression
+	// that follows it: `await a.b()`, `await (a || b)`, `(await x) + 1`
+	_ = pb.RegisterPrefixOperator(awaitToken, func(tok token.Token, right func() ast.Expression) ast.Expression {
+		ae := &AwaitExpression{Token: tok, Right: right()}
+		// `await f() or { ... }` guards the awaited value, so the fallback
+		// also runs when the promise rejects
+		if oe, ok := ae.Right.(*OrExpression); ok {
+			ae.Right = oe.Expression
+			oe.Expression = ae
+			return oe
 		}
+		return ae
 	})
 
 	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
-		asyncFn := p.CurrentToken.Type == asyncToken
+		asyncFn := p.CurrentToken.Type == asyncToken && p.PeekToken.Type == token.FUNCTION
 		if p.CurrentToken.Type != token.FUNCTION && !asyncFn {
 			return next()
 		}
 		if asyncFn {
 			p.NextToken() // consume 'async'
 		}
+		fd := p.ParseFunctionStatement()
+		if fd != nil {
+			checkFunctionBody(p, fd.Body, asyncFn)
+		}
 		return &DeferFunctionDeclaration{
 			asyncFn:             asyncFn,
 			prefix:              id.String(),
-			FunctionDeclaration: p.ParseFunctionStatement(),
+			FunctionDeclaration: fd,
 		}
 	})
 
 	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
-		asyncFn := p.CurrentToken.Type == asyncToken
-		if p.CurrentToken.Type != token.FUNCTION && !asyncFn {
+		if p.CurrentToken.Type == asyncToken {
+			return parseAsyncExpression(p, arrowToken, id.String())
+		}
+		if p.CurrentToken.Type != token.FUNCTION {
 			return next()
 		}
-		if asyncFn {
-			p.NextToken() // consume 'async'
+		return parseFunctionExpression(p, false, id.String())
+	})
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != token.FOR || p.PeekToken.Type != awaitToken {
+			return next()
 		}
-		expr := p.ParseFunctionExpression()
-		if fe, ok := expr.(*ast.FunctionExpression); ok {
-			return &DeferFunctionExpression{
-				asyncFn:            asyncFn,
-				prefix:             id.String(),
-				FunctionExpression: fe,
-			}
+		stmt := &ForAwaitStatement{Token: p.CurrentToken}
+		p.NextToken() // consume 'await'
+		if !p.ExpectToken(token.LPAREN) || !p.ExpectToken(token.LET) || !p.ExpectToken(token.IDENT) {
+			return nil
 		}
-		return expr
+		stmt.Name = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		if !expectContextualKeyword(p, "of") {
+			return nil
+		}
+		p.NextToken() // move to the iterable
+		stmt.Iterable = p.ParseExpression()
+		if !p.ExpectToken(token.RPAREN) {
+			return nil
+		}
+		p.NextToken() // move to the body
+		stmt.Body = p.ParseStatement()
+		if stmt.Body == nil {
+			return nil
+		}
+		return stmt
 	})
 
 	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
@@ -179,8 +380,8 @@ func DeferPlugin(pb *parser.Builder) {
 			return next()
 		}
 
-		if !p.IsInFunction() {
-			p.AddError("defer statement can only be used inside functions")
+		if !p.IsInFunction() && p.CurrentContext() != moduleContext {
+			p.AddError("defer statement can only be used inside functions or at the top level")
 			return nil
 		}
 
@@ -200,4 +401,228 @@ func DeferPlugin(pb *parser.Builder) {
 		}
 		return stmt
 	})
+	// `use` is a contextual keyword: it is only recognized when followed by an
+	// identifier or `await`, so expressions like `app.use(fn)` keep working
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != token.IDENT || p.CurrentToken.Literal != "use" {
+			return next()
+		}
+		if p.PeekToken.Type != token.IDENT && p.PeekToken.Type != awaitToken {
+			return next()
+		}
+
+		if !p.IsInFunction() && p.CurrentContext() != moduleContext {
+			p.AddError("use declaration can only be used inside functions or at the top level")
+			return nil
+		}
+
+		stmt := &UseStatement{
+			Token:          p.CurrentToken,
+			prefix:         id.String(),
+			disposeMethods: disposeMethods,
+		}
+		if p.PeekToken.Type == awaitToken {
+			p.NextToken() // consume 'await'
+			stmt.Await = true
+		}
+		if !p.ExpectToken(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		if !p.ExpectToken(token.ASSIGN) {
+			return nil
+		}
+		p.NextToken() // move to value
+		stmt.Value = p.ParseExpression()
+		if !p.ExpectSemicolonASI() {
+			return nil
+		}
+		return stmt
+	})
+}
+
+// checkFunctionBody reports `use await` declarations in the body of a
+// function that is not async, and lets the defers of async functions await.
+func checkFunctionBody(p *parser.Parser, body *ast.BlockStatement, asyncFn bool) {
+	if body == nil {
+		return
+	}
+	for _, stmt := range deferredStatements(body.Statements) {
+		switch s := stmt.(type) {
+		case *DeferStatement:
+			s.async = asyncFn
+		case *UseStatement:
+			if s.Await && !asyncFn {
+				p.AddErrorAtToken("use await can only be used inside async functions", s.Token)
+			}
+		}
+	}
+}
+
+// parseFunctionExpression parses a function expression, the current token
+// being 'function'.
+func parseFunctionExpression(p *parser.Parser, asyncFn bool, prefix string) ast.Expression {
+	expr := p.ParseFunctionExpression()
+	fe, ok := expr.(*ast.FunctionExpression)
+	if !ok {
+		return expr
+	}
+	checkFunctionBody(p, fe.Body, asyncFn)
+	return &DeferFunctionExpression{
+		asyncFn:            asyncFn,
+		prefix:             prefix,
+		FunctionExpression: fe,
+	}
+}
+
+// parseAsyncExpression parses the expression starting with 'async': an async
+// function, an async arrow function, or `async` used as an identifier.
+func parseAsyncExpression(p *parser.Parser, arrowToken token.Type, prefix string) ast.Expression {
+	asyncTok := p.CurrentToken
+	ident := &ast.Identifier{Token: asyncTok, Value: asyncTok.Literal}
+	switch {
+	case p.PeekToken.Type == token.FUNCTION:
+		p.NextToken() // consume 'async'
+		return parseFunctionExpression(p, true, prefix)
+	case p.PeekToken.Type == token.IDENT && !p.PeekToken.AfterNewline:
+		// async x => ...
+		p.NextToken() // consume 'async'
+		param := &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		if !p.ExpectToken(arrowToken) {
+			return nil
+		}
+		return parseArrowBody(p, &AsyncArrowFunction{Token: asyncTok, Parameters: []*ast.Identifier{param}, prefix: prefix})
+	case p.PeekToken.Type == token.LPAREN:
+		// async (a, b) => ..., or a call to a function named async
+		p.NextToken() // consume 'async'
+		callTok := p.CurrentToken
+		args := p.ParseExpressionList(token.RPAREN)
+		if args == nil {
+			return nil
+		}
+		if p.PeekToken.Type != arrowToken {
+			call := &ast.CallExpression{Token: callTok, Function: ident, Arguments: args}
+			return p.ParseRemainingExpression(call)
+		}
+		af := &AsyncArrowFunction{Token: asyncTok, prefix: prefix}
+		for _, arg := range args {
+			// a rest parameter was parsed as a spread: async (...args) => ...
+			if se, ok := arg.(*SpreadElement); ok {
+				if name, ok := se.Argument.(*ast.Identifier); ok {
+					arg = &ast.Identifier{Token: se.Token, Value: "..." + name.Value}
+				}
+			}
+			param, ok := arg.(*ast.Identifier)
+			if !ok {
+				p.AddErrorAtToken("arrow function parameters must be identifiers", callTok)
+				return nil
+			}
+			af.Parameters = append(af.Parameters, param)
+		}
+		p.NextToken() // consume ')'
+		return parseArrowBody(p, af)
+	}
+	return p.ParseRemainingExpression(ident)
+}
+
+// parseArrowBody parses the body of an async arrow function, the current
+// token being '=>'.
+func parseArrowBody(p *parser.Parser, af *AsyncArrowFunction) ast.Expression {
+	p.PushContext(parser.FunctionContext)
+	defer p.PopContext()
+	p.NextToken() // consume '=>'
+	if p.CurrentToken.Type == token.LBRACE {
+		af.Body = p.ParseBlockStatement()
+		checkFunctionBody(p, af.Body, true)
+	} else {
+		af.Expression = p.ParseExpression()
+	}
+	return af
+}
+
+// readAsyncMethod reads the tokens that follow an 'async' token. An async
+// method in an object literal, `async name(params) { ... }` or, for async
+// generators, `async *name(params) { ... }`, is returned as the tokens of
+// `name: async function(params) { ... }`, so the object literal parser reads
+// it as a property. Otherwise the tokens are returned as read, after 'async'.
+func readAsyncMethod(l *lexer.Lexer, asyncTok token.Token) []token.Token {
+	read := []token.Token{asyncTok, l.NextToken()}
+	fnTok := asyncTok
+	fnTok.Type = token.FUNCTION
+	fnTok.Literal = "function"
+	fnTok.AfterNewline = false
+	if read[1].Type == token.MULTIPLY {
+		fnTok.Literal = "function*"
+		read = append(read, l.NextToken())
+	}
+	name := read[len(read)-1]
+	if name.Type != token.IDENT || name.AfterNewline {
+		return read
+	}
+	read = append(read, l.NextToken())
+	lparen := read[len(read)-1]
+	if lparen.Type != token.LPAREN {
+		return read
+	}
+	colon := token.Token{Start: name.Start, Type: token.COLON, Literal: ":", Line: name.Line, Column: name.Column}
+	name.AfterNewline = asyncTok.AfterNewline
+	asyncTok.AfterNewline = false
+	return []token.Token{name, colon, asyncTok, fnTok, lparen}
+}
+
+// deferredStatements returns the `defer` and `use` statements that push onto
+// the defer stack of the enclosing function, including those nested in blocks,
+// loops, conditionals and try statements.
+func deferredStatements(stmts []ast.Statement) []ast.Statement {
+	var ret []ast.Statement
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *DeferStatement, *UseStatement:
+			ret = append(ret, s)
+		case *ast.BlockStatement:
+			ret = append(ret, deferredStatements(s.Statements)...)
+		case *ast.IfStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.ThenBranch, s.ElseBranch})...)
+		case *ast.WhileStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *ast.ForStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *ForAwaitStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *ForOfStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *ForInStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *DoWhileStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *LabeledStatement:
+			ret = append(ret, deferredStatements([]ast.Statement{s.Body})...)
+		case *CommentedStatement:
+			// a comment kept with --preserve-comments
+			ret = append(ret, deferredStatements([]ast.Statement{s.Statement})...)
+		case *SwitchStatement:
+			for _, c := range s.Cases {
+				ret = append(ret, deferredStatements(c.Consequent)...)
+			}
+		case *TryStatement:
+			for _, block := range []*ast.BlockStatement{s.Block, s.CatchBlock, s.FinallyBlock} {
+				if block != nil {
+					ret = append(ret, deferredStatements(block.Statements)...)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// deferPrefix returns the unique prefix of the defer stack a `defer` or `use`
+// statement pushes onto.
+func deferPrefix(stmt ast.Statement) string {
+	switch s := stmt.(type) {
+	case *DeferStatement:
+		return s.prefix
+	case *UseStatement:
+		return s.prefix
+	}
+	return ""
 }
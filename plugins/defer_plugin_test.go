@@ -2,8 +2,10 @@ package plugins
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/xjslang/xjs/compiler"
 	"github.com/xjslang/xjs/lexer"
 	"github.com/xjslang/xjs/parser"
 )
@@ -100,3 +102,307 @@ func TestDeferSemicolonHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestUseDeclaration(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "use inside function",
+			input: `function main() { use f = open(p) }`,
+		},
+		{
+			name:  "use await inside async function",
+			input: `async function main() { use await f = open(p) }`,
+		},
+		{
+			name:  "use as a method name",
+			input: `app.use(handler)`,
+		},
+		{
+			name:    "use outside function",
+			input:   `use f = open(p)`,
+			wantErr: true,
+		},
+		{
+			name:    "use await inside non-async function",
+			input:   `function main() { use await f = open(p) }`,
+			wantErr: true,
+		},
+		{
+			name:    "use without initializer",
+			input:   `function main() { use f }`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).Install(DeferPlugin).Build(tt.input)
+			_, err := p.ParseProgram()
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected error for %s, but got none", tt.name)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error for %s, got: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestUseCustomDisposeMethods(t *testing.T) {
+	input := `function main() { use f = open(p) }`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).Install(DeferPluginWithDisposeMethods("shutdown")).Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	code := compiler.New().Compile(prog).Code
+	if !strings.Contains(code, "(Symbol.dispose&&f[Symbol.dispose])||f.shutdown;") {
+		t.Errorf("Expected custom dispose method in output, got:\n%s", code)
+	}
+	if strings.Contains(code, "f.close") {
+		t.Errorf("Expected default dispose methods to be replaced, got:\n%s", code)
+	}
+}
+
+func TestAwaitExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "await call",
+			input:    `async function f() { await run() }`,
+			expected: `async function f(){await run()}`,
+		},
+		{
+			name:     "await identifier",
+			input:    `async function f() { let v = await promise }`,
+			expected: `async function f(){let v=await promise}`,
+		},
+		{
+			name:     "await member expression",
+			input:    `async function f() { await this.ready }`,
+			expected: `async function f(){await this.ready}`,
+		},
+		{
+			name:     "await grouped expression",
+			input:    `async function f() { await (a || b) }`,
+			expected: `async function f(){await ((a||b))}`,
+		},
+		{
+			name:     "await binds tighter than binary operators",
+			input:    `async function f() { return await a + await b }`,
+			expected: `async function f(){return (await a+await b)}`,
+		},
+		{
+			name:     "await new expression",
+			input:    `async function f() { await new Promise(start) }`,
+			expected: `async function f(){await new Promise(start)}`,
+		},
+		{
+			name:     "nested await",
+			input:    `async function f() { await await load() }`,
+			expected: `async function f(){await await load()}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				Install(DeferPlugin).
+				Install(NewPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestForAwait(t *testing.T) {
+	input := `async function lines(stream) {
+		for await (let line of stream) {
+			defer console.log("done")
+			console.log(line)
+		}
+	}`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).Install(DeferPlugin).Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	if !strings.Contains(result.Code, "for await(let line of stream){") {
+		t.Errorf("Expected for await loop, got:\n%s", result.Code)
+	}
+	// defers inside the loop use the function's defer stack
+	if !strings.Contains(result.Code, "let defers_") {
+		t.Errorf("Expected defer stack in function, got:\n%s", result.Code)
+	}
+
+	for _, input := range []string{
+		`async function f(s) { for await (x of s) {} }`,
+		`async function f(s) { for await (let x in s) {} }`,
+		`async function f(s) { for await (let x of s {} }`,
+	} {
+		p := parser.NewBuilder(lexer.NewBuilder()).Install(DeferPlugin).Build(input)
+		if _, err := p.ParseProgram(); err == nil {
+			t.Errorf("Expected error for %q, but got none", input)
+		}
+	}
+}
+
+func TestAsyncFunctionForms(t *testing.T) {
+	const awaitDefers = `finally{for(let i_=defers_.length;i_>0;i_--){try{await defers_[i_-1]()}catch(e_){console.log(e_)}}}`
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "async arrow with one parameter",
+			input:    `let f = async x => await load(x)`,
+			expected: `let f=async (x) =>await load(x)`,
+		},
+		{
+			name:     "async arrow with parameters and block body",
+			input:    `let f = async (a, b) => { return await add(a, b) }`,
+			expected: `let f=async (a,b) =>{return await add(a,b)}`,
+		},
+		{
+			name:     "async arrow returning an object",
+			input:    `let f = async () => ({ ok: true })`,
+			expected: `let f=async () =>({ok:true})`,
+		},
+		{
+			name:     "async arrow with defers",
+			input:    "let f = async () => {\n defer await conn.close()\n await conn.query()\n}",
+			expected: `let f=async () =>{let defers_=[];try{defers_.push(async () =>{await conn.close()});await conn.query()}` + awaitDefers + `}`,
+		},
+		{
+			name:     "async function awaits its defers",
+			input:    "async function f() {\n defer cleanup()\n await work()\n}",
+			expected: `async function f() {let defers_=[];try{defers_.push(async () =>{cleanup()});await work()}` + awaitDefers + `}`,
+		},
+		{
+			name:     "async object method",
+			input:    "let db = { name: 'main', async close() {\n defer log()\n await flush()\n} }",
+			expected: `let db={close:async function() {let defers_=[];try{defers_.push(async () =>{log()});await flush()}` + awaitDefers + `},name:"main"}`,
+		},
+		{
+			name:     "async generator method",
+			input:    `let src = { async *rows() { yield await next() } }`,
+			expected: `let src={rows:async function*(){yield await next()}}`,
+		},
+		{
+			name:     "async generator function",
+			input:    `async function* rows(db) { yield await db.next() }`,
+			expected: `async function* rows(db){yield await db.next()}`,
+		},
+		{
+			name:     "async as an identifier",
+			input:    `let o = { async: 1 }; async(o.async)`,
+			expected: `let o={async:1};async(o.async)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(DeferPlugin).
+				Install(GeneratorPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			code := modulePrefix.ReplaceAllString(result.Code, "_")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestAwaitWithOr(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "await statement with fallback",
+			input:    `async function f() { await run() or |err| { console.log(err) } }`,
+			expected: `async function f(){try{await run()}catch(err){console.log(err)}}`,
+		},
+		{
+			name:     "let with awaited value and fallback",
+			input:    `async function f() { let v = await load() or { return } }`,
+			expected: `async function f(){let v;try{v=await load()}catch{return}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				Install(DeferPlugin).
+				Install(OrPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestDeferWithPreservedComments(t *testing.T) {
+	input := `function f() {
+		/** Closes the connection when f returns. */
+		defer { close() }
+		/*! kept */
+		use file = open()
+		work()
+	}`
+	p := parser.NewBuilder(lexer.NewBuilder()).
+		WithSmartSemicolon(true).
+		Install(DeferPlugin).
+		Install(PreserveCommentsPlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	code := compiler.New().Compile(prog).Code
+	for _, want := range []string{
+		"/** Closes the connection when f returns. */\ndefers_",
+		"/*! kept */\nlet file=open();defers_",
+		"finally{",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, code)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package plugins
+
+import (
+	"github.com/xjslang/xjs/ast"
+)
+
+// Feature is a JavaScript feature of compiled code that older runtimes
+// can't parse.
+type Feature string
+
+const (
+	OptionalChaining  Feature = "optional chaining (?.)"
+	NullishCoalescing Feature = "nullish coalescing (??)"
+	LogicalAssignment Feature = "logical assignment (??=)"
+	TopLevelAwait     Feature = "top-level await in ES modules"
+)
+
+// ProgramFeatures returns the features that the compiled code of a program
+// uses, in the order they are declared. Operators lowered by
+// DownlevelOperatorsPlugin, and top-level await in CommonJS, which runs in
+// an async function, are not included.
+func ProgramFeatures(program *ast.Program) []Feature {
+	found := map[Feature]bool{}
+	walk(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ModuleBody:
+			found[TopLevelAwait] = found[TopLevelAwait] || !n.commonJS && n.awaits()
+		case *OptionalChainHead:
+			found[OptionalChaining] = found[OptionalChaining] || n.param == ""
+		case *NullishExpression:
+			found[NullishCoalescing] = found[NullishCoalescing] || !n.downlevel
+		case *NullishAssignmentExpression:
+			found[LogicalAssignment] = found[LogicalAssignment] || !n.downlevel
+		}
+		return true
+	})
+	var features []Feature
+	for _, f := range []Feature{OptionalChaining, NullishCoalescing, LogicalAssignment, TopLevelAwait} {
+		if found[f] {
+			features = append(features, f)
+		}
+	}
+	return features
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestProgramFeatures(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		esm       bool
+		downlevel bool
+		expected  []Feature
+	}{
+		{
+			name:  "no features",
+			input: `let x = a || b`,
+		},
+		{
+			name:     "optional chaining",
+			input:    `let x = a?.b.c`,
+			expected: []Feature{OptionalChaining},
+		},
+		{
+			name:     "nullish coalescing",
+			input:    `let x = a ?? b`,
+			expected: []Feature{NullishCoalescing},
+		},
+		{
+			name:     "logical assignment",
+			input:    `x ??= 1`,
+			expected: []Feature{LogicalAssignment},
+		},
+		{
+			name:     "features inside functions",
+			input:    "function f(a) {\n return a?.b ?? 0\n}",
+			expected: []Feature{OptionalChaining, NullishCoalescing},
+		},
+		{
+			name:      "downlevel operators",
+			input:     "let x = a?.b ?? c\nx ??= 1",
+			downlevel: true,
+		},
+		{
+			name:     "top-level await in ES modules",
+			input:    `let data = await load()`,
+			esm:      true,
+			expected: []Feature{TopLevelAwait},
+		},
+		{
+			name:     "top-level use await in ES modules",
+			input:    `use await db = open()`,
+			esm:      true,
+			expected: []Feature{TopLevelAwait},
+		},
+		{
+			name:  "top-level await in CommonJS",
+			input: `let data = await load()`,
+		},
+		{
+			name:  "await inside an async function",
+			input: `async function f() { await load() }`,
+			esm:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules, operators := CommonJSModulesPlugin, OperatorsPlugin
+			if tt.esm {
+				modules = ModulesPlugin
+			}
+			if tt.downlevel {
+				operators = DownlevelOperatorsPlugin
+			}
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(modules).
+				Install(DeferPlugin).
+				Install(operators).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if features := ProgramFeatures(prog); !reflect.DeepEqual(features, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, features)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// YieldExpression represents `yield`, `yield value` or `yield* iterable` in
+// a generator.
+type YieldExpression struct {
+	Token    token.Token    // the 'yield' token
+	Argument ast.Expression // the yielded value (can be nil)
+	Delegate bool           // true for `yield*`, which yields each value of an iterable
+}
+
+func (ye *YieldExpression) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ye.Token.Start)
+	cw.WriteString("yield")
+	if ye.Delegate {
+		cw.WriteRune('*')
+	}
+	if ye.Argument != nil {
+		cw.WriteRune(' ')
+		ye.Argument.WriteTo(cw)
+	}
+}
+
+// ForOfStatement represents `for (let x of iterable) body`. Breaking out of
+// the loop closes the iterator, which runs the defers of a generator.
+type ForOfStatement struct {
+	Token    token.Token // the 'for' token
+	Name     *ast.Identifier
+	Iterable ast.Expression
+	Body     ast.Statement
+	Assign   bool // true for `for (x of iterable)`, which assigns an existing variable
+}
+
+func (fs *ForOfStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(fs.Token.Start)
+	cw.WriteString("for(")
+	if !fs.Assign {
+		cw.WriteString("let ")
+	}
+	fs.Name.WriteTo(cw)
+	cw.WriteString(" of ")
+	fs.Iterable.WriteTo(cw)
+	cw.WriteRune(')')
+	fs.Body.WriteTo(cw)
+}
+
+// GeneratorPlugin adds generator functions (`function*` and
+// `async function*`), `yield` and `yield*` expressions, and `for...of` loops.
+// Defers in a generator run when it completes, throws, or when the consumer
+// stops early.
+func GeneratorPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	yieldToken := lb.RegisterTokenType("YIELD")
+	inToken := lb.RegisterTokenType("IN")
+
+	// 'function' followed by '*' becomes a single FUNCTION token, so the
+	// function parsers need no changes
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		switch {
+		case ret.Type == token.FUNCTION:
+			for l.CurrentChar == ' ' || l.CurrentChar == '\t' {
+				l.ReadChar()
+			}
+			if l.CurrentChar == '*' {
+				l.ReadChar() // consume '*'
+				ret.Literal = "function*"
+			}
+		case ret.Type == token.IDENT && ret.Literal == "yield":
+			ret.Type = yieldToken
+		}
+		return ret
+	})
+
+	// generator functions are written by DeferPlugin when it is installed;
+	// otherwise they are wrapped here so the '*' is kept
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != token.FUNCTION || p.CurrentToken.Literal != "function*" {
+			return next()
+		}
+		return &DeferFunctionDeclaration{FunctionDeclaration: p.ParseFunctionStatement()}
+	})
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != token.FUNCTION || p.CurrentToken.Literal != "function*" {
+			return next()
+		}
+		if fe, ok := p.ParseFunctionExpression().(*ast.FunctionExpression); ok {
+			return &DeferFunctionExpression{FunctionExpression: fe}
+		}
+		return nil
+	})
+
+	// `yield` takes an optional value, so it ends at a closing token or a
+	// line break: `yield`, `let x = yield`, `yield a + b`
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != yieldToken {
+			return next()
+		}
+		ye := &YieldExpression{Token: p.CurrentToken}
+		if p.PeekToken.Type == token.MULTIPLY {
+			p.NextToken() // consume '*'
+			ye.Delegate = true
+			p.NextToken() // move to the iterable
+			ye.Argument = p.ParseExpression()
+			return ye
+		}
+		switch p.PeekToken.Type {
+		case token.SEMICOLON, token.RPAREN, token.RBRACKET, token.RBRACE, token.COMMA, token.COLON, token.EOF:
+			return ye
+		}
+		if p.PeekToken.AfterNewline {
+			return ye
+		}
+		p.NextToken() // move to the value
+		ye.Argument = p.ParseExpression()
+		return ye
+	})
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != token.FOR || p.PeekToken.Type != token.LPAREN {
+			return next()
+		}
+		// `for...in` is only enabled by CompatPlugin, which lexes the IN token
+		return parseForStatement(p, inToken)
+	})
+}
@@ -0,0 +1,122 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "generator declaration",
+			input:    `function* count(n) { let i = 0; while (i < n) { yield i; i = i + 1 } }`,
+			expected: `function* count(n){let i=0;while ((i<n)){yield i;i=(i+1)}}`,
+		},
+		{
+			name:     "space before the star",
+			input:    `function *ids() { yield 1 }`,
+			expected: `function* ids(){yield 1}`,
+		},
+		{
+			name:     "generator expression",
+			input:    `let g = function*() { yield }`,
+			expected: `let g=function*(){yield}`,
+		},
+		{
+			name:     "yield ends at a line break",
+			input:    "function* g() {\n yield\n run()\n}",
+			expected: `function* g(){yield;run()}`,
+		},
+		{
+			name:     "yield receives a value",
+			input:    `function* g() { let x = yield 1; console.log(x) }`,
+			expected: `function* g(){let x=yield 1;console.log(x)}`,
+		},
+		{
+			name:     "yield takes the whole expression",
+			input:    `function* g(a) { yield a + 1 }`,
+			expected: `function* g(a){yield (a+1)}`,
+		},
+		{
+			name:     "yield delegates to another iterable",
+			input:    `function* all(a, b) { yield* a; yield *b }`,
+			expected: `function* all(a,b){yield* a;yield* b}`,
+		},
+		{
+			name:     "for...of loop",
+			input:    `for (let x of count(3)) { console.log(x) }`,
+			expected: `for(let x of count(3)){console.log(x)}`,
+		},
+		{
+			name:     "regular for loop",
+			input:    `for (let i = 0; i < 3; i = i + 1) { console.log(i) }`,
+			expected: `for (let i=0;(i<3);i=(i+1)){console.log(i)}`,
+		},
+		{
+			name:     "for loop without declaration",
+			input:    `for (; ready(); ) { step() }`,
+			expected: `for (;ready();){step()}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, withDefer := range []bool{false, true} {
+				pb := parser.NewBuilder(lexer.NewBuilder()).WithSmartSemicolon(true)
+				if withDefer {
+					pb = pb.Install(DeferPlugin)
+				}
+				p := pb.Install(GeneratorPlugin).Build(tt.input)
+				prog, err := p.ParseProgram()
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				result := compiler.New().Compile(prog)
+				if result.Code != tt.expected {
+					t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratorDefers(t *testing.T) {
+	input := "function* lines(file) {\n defer file.close()\n for (let line of file.lines) {\n  yield line\n }\n}"
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		WithSmartSemicolon(true).
+		Install(DeferPlugin).
+		Install(GeneratorPlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	code := modulePrefix.ReplaceAllString(result.Code, "_")
+	expected := `function* lines(file) {let defers_=[];try{defers_.push(() =>{file.close()});for(let line of file.lines){yield line}}` +
+		`finally{for(let i_=defers_.length;i_>0;i_--){try{defers_[i_-1]()}catch(e_){console.log(e_)}}}}`
+	if code != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, code)
+	}
+}
+
+func TestForOfErrorCases(t *testing.T) {
+	for _, input := range []string{
+		`for (let x of items { }`,
+		`for (let of items) { }`,
+		`for (let x = 0 i < 3; i++) { }`,
+	} {
+		p := parser.NewBuilder(lexer.NewBuilder()).Install(GeneratorPlugin).Build(input)
+		if _, err := p.ParseProgram(); err == nil {
+			t.Errorf("Expected error for %q, but got none", input)
+		}
+	}
+}
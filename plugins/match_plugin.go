@@ -0,0 +1,500 @@
+package plugins
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rs/xid"
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// matchPath writes the JavaScript expression that reaches a (sub)value of the
+// matched subject, e.g. `match_x[0].status`.
+type matchPath func(cw *ast.CodeWriter)
+
+type matchBinding struct {
+	Name *ast.Identifier
+	Path matchPath
+}
+
+// MatchPattern is the left-hand side of a match arm.
+type MatchPattern interface {
+	// refutable reports whether the pattern can fail to match
+	refutable() bool
+	// writeTest writes a condition checking the value at path; it is only
+	// called for refutable patterns
+	writeTest(cw *ast.CodeWriter, path matchPath)
+	// bindings returns the identifiers bound by the pattern
+	bindings(path matchPath) []matchBinding
+}
+
+// WildcardPattern (`_`) matches any value without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) refutable() bool                              { return false }
+func (wp *WildcardPattern) writeTest(cw *ast.CodeWriter, path matchPath) {}
+func (wp *WildcardPattern) bindings(path matchPath) []matchBinding       { return nil }
+
+// BindingPattern matches any value and binds it to a name.
+type BindingPattern struct {
+	Name *ast.Identifier
+}
+
+func (bp *BindingPattern) refutable() bool                              { return false }
+func (bp *BindingPattern) writeTest(cw *ast.CodeWriter, path matchPath) {}
+func (bp *BindingPattern) bindings(path matchPath) []matchBinding {
+	return []matchBinding{{Name: bp.Name, Path: path}}
+}
+
+// LiteralPattern matches a number, string, boolean or null using strict equality.
+type LiteralPattern struct {
+	Value ast.Expression
+}
+
+func (lp *LiteralPattern) refutable() bool { return true }
+func (lp *LiteralPattern) writeTest(cw *ast.CodeWriter, path matchPath) {
+	path(cw)
+	cw.WriteString("===")
+	lp.Value.WriteTo(cw)
+}
+func (lp *LiteralPattern) bindings(path matchPath) []matchBinding { return nil }
+
+// RangePattern (`low..high`) matches numbers between both bounds, inclusive.
+type RangePattern struct {
+	Token token.Token // the first '.' token
+	Low   ast.Expression
+	High  ast.Expression
+}
+
+func (rp *RangePattern) refutable() bool { return true }
+func (rp *RangePattern) writeTest(cw *ast.CodeWriter, path matchPath) {
+	cw.AddMapping(rp.Token.Start)
+	cw.WriteString("typeof ")
+	path(cw)
+	cw.WriteString("===\"number\"&&")
+	path(cw)
+	cw.WriteString(">=")
+	rp.Low.WriteTo(cw)
+	cw.WriteString("&&")
+	path(cw)
+	cw.WriteString("<=")
+	rp.High.WriteTo(cw)
+}
+func (rp *RangePattern) bindings(path matchPath) []matchBinding { return nil }
+
+// ArrayPattern matches arrays of exactly the same length whose elements match.
+type ArrayPattern struct {
+	Token    token.Token // the [ token
+	Elements []MatchPattern
+}
+
+func (ap *ArrayPattern) refutable() bool { return true }
+func (ap *ArrayPattern) writeTest(cw *ast.CodeWriter, path matchPath) {
+	cw.AddMapping(ap.Token.Start)
+	cw.WriteString("Array.isArray(")
+	path(cw)
+	cw.WriteString(")&&")
+	path(cw)
+	cw.WriteString(".length===" + strconv.Itoa(len(ap.Elements)))
+	for i, elem := range ap.Elements {
+		if elem.refutable() {
+			cw.WriteString("&&(")
+			elem.writeTest(cw, ap.elementPath(path, i))
+			cw.WriteRune(')')
+		}
+	}
+}
+func (ap *ArrayPattern) bindings(path matchPath) []matchBinding {
+	var ret []matchBinding
+	for i, elem := range ap.Elements {
+		ret = append(ret, elem.bindings(ap.elementPath(path, i))...)
+	}
+	return ret
+}
+func (ap *ArrayPattern) elementPath(path matchPath, index int) matchPath {
+	return func(cw *ast.CodeWriter) {
+		path(cw)
+		cw.WriteString("[" + strconv.Itoa(index) + "]")
+	}
+}
+
+// ObjectPatternProperty is a `key: pattern` entry of an object pattern.
+// The shorthand `{key}` binds the property to a variable of the same name.
+type ObjectPatternProperty struct {
+	Key     ast.Expression // *ast.Identifier or *ast.StringLiteral
+	Pattern MatchPattern
+}
+
+// ObjectPattern matches non-null values whose listed properties match.
+type ObjectPattern struct {
+	Token      token.Token // the { token
+	Properties []ObjectPatternProperty
+}
+
+func (op *ObjectPattern) refutable() bool { return true }
+func (op *ObjectPattern) writeTest(cw *ast.CodeWriter, path matchPath) {
+	cw.AddMapping(op.Token.Start)
+	path(cw)
+	cw.WriteString("!=null")
+	for _, prop := range op.Properties {
+		if prop.Pattern.refutable() {
+			cw.WriteString("&&(")
+			prop.Pattern.writeTest(cw, op.propertyPath(path, prop.Key))
+			cw.WriteRune(')')
+		}
+	}
+}
+func (op *ObjectPattern) bindings(path matchPath) []matchBinding {
+	var ret []matchBinding
+	for _, prop := range op.Properties {
+		ret = append(ret, prop.Pattern.bindings(op.propertyPath(path, prop.Key))...)
+	}
+	return ret
+}
+func (op *ObjectPattern) propertyPath(path matchPath, key ast.Expression) matchPath {
+	return func(cw *ast.CodeWriter) {
+		path(cw)
+		if _, ok := key.(*ast.StringLiteral); ok {
+			cw.WriteRune('[')
+			key.WriteTo(cw)
+			cw.WriteRune(']')
+		} else {
+			cw.WriteRune('.')
+			key.WriteTo(cw)
+		}
+	}
+}
+
+// MatchArm is a single `pattern [if guard] => body` entry.
+type MatchArm struct {
+	Pattern MatchPattern
+	Guard   ast.Expression      // optional
+	Body    ast.Expression      // set for expression bodies
+	Block   *ast.BlockStatement // set for block bodies
+}
+
+// MatchExpression represents `match (subject) { arms }`. It compiles to an
+// arrow IIFE, so it can be used in expression position. Arms that use
+// `await` make it an async arrow whose result is awaited, and arms that use
+// `yield` make it a generator that the enclosing generator delegates to, so
+// both keep working inside the arms.
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject ast.Expression
+	Arms    []*MatchArm
+	prefix  string
+	await   bool // an arm awaits
+	yield   bool // an arm yields
+}
+
+// scanArms records whether the arms await or yield, outside of the
+// functions they contain.
+func (me *MatchExpression) scanArms() {
+	for _, arm := range me.Arms {
+		for _, node := range []ast.Node{arm.Guard, arm.Body, arm.Block} {
+			walk(node, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *AwaitExpression, *ForAwaitStatement:
+					me.await = true
+				case *YieldExpression:
+					me.yield = true
+				case *UseStatement:
+					me.await = me.await || n.Await
+				}
+				return !isFunction(n)
+			})
+		}
+	}
+}
+
+func (me *MatchExpression) WriteTo(cw *ast.CodeWriter) {
+	subjectName := "match_" + me.prefix
+	subject := func(cw *ast.CodeWriter) {
+		cw.WriteString(subjectName)
+	}
+
+	cw.AddMapping(me.Token.Start)
+	switch {
+	case me.yield:
+		cw.WriteString("(yield* (")
+		if me.await {
+			cw.WriteString("async ")
+		}
+		cw.WriteString("function*(" + subjectName + "){")
+	case me.await:
+		cw.WriteString("(await (async (" + subjectName + ") =>{")
+	default:
+		cw.WriteString("((" + subjectName + ") =>{")
+	}
+	for _, arm := range me.Arms {
+		if arm.Pattern.refutable() {
+			cw.WriteString("if(")
+			arm.Pattern.writeTest(cw, subject)
+			cw.WriteRune(')')
+		}
+		cw.WriteRune('{')
+		for _, b := range arm.Pattern.bindings(subject) {
+			cw.WriteString("let ")
+			b.Name.WriteTo(cw)
+			cw.WriteRune('=')
+			b.Path(cw)
+			cw.WriteRune(';')
+		}
+		if arm.Guard != nil {
+			cw.WriteString("if(")
+			arm.Guard.WriteTo(cw)
+			cw.WriteString("){")
+		}
+		if arm.Block != nil {
+			arm.Block.WriteTo(cw)
+			cw.WriteString("return")
+		} else {
+			cw.WriteString("return ")
+			arm.Body.WriteTo(cw)
+		}
+		if arm.Guard != nil {
+			cw.WriteRune('}')
+		}
+		cw.WriteRune('}')
+	}
+	cw.AddMapping(me.Token.Start)
+	message := fmt.Sprintf("non-exhaustive match at line %d, column %d: ", me.Token.Start.Line, me.Token.Start.Column)
+	cw.WriteString("throw new Error(" + strconv.Quote(message) + "+String(" + subjectName + "))})")
+	if me.yield {
+		// generator functions don't keep `this` like arrows
+		cw.WriteString(".call(this,")
+	} else {
+		cw.WriteRune('(')
+	}
+	me.Subject.WriteTo(cw)
+	cw.WriteRune(')')
+	if me.yield || me.await {
+		cw.WriteRune(')')
+	}
+}
+
+// MatchPlugin adds the `match` expression with literal, range, array and
+// object patterns and `if` guards:
+//
+//	let label = match (code) {
+//	  0 => "ok"
+//	  1..9 => "warning"
+//	  n if n > 100 => "fatal " + n
+//	  _ => "error"
+//	}
+func MatchPlugin(pb *parser.Builder) {
+	id := xid.New()
+	lb := pb.LexerBuilder
+	arrowTokenType := useArrowToken(lb)
+
+	// `match` is a contextual keyword: `match(x)` not followed by `{` is a
+	// regular call, so functions and methods named match keep working
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != token.IDENT || p.CurrentToken.Literal != "match" || p.PeekToken.Type != token.LPAREN {
+			return next()
+		}
+
+		tok := p.CurrentToken
+		p.NextToken() // move to (
+		lparen := p.CurrentToken
+		args := p.ParseExpressionList(token.RPAREN)
+		if args == nil {
+			return nil
+		}
+		if len(args) != 1 || p.PeekToken.Type != token.LBRACE {
+			call := &ast.CallExpression{
+				Token:     lparen,
+				Function:  &ast.Identifier{Token: tok, Value: tok.Literal},
+				Arguments: args,
+			}
+			return p.ParseRemainingExpression(call)
+		}
+
+		me := &MatchExpression{Token: tok, Subject: args[0], prefix: id.String()}
+		p.NextToken() // consume {
+		for {
+			p.NextToken()
+			if p.CurrentToken.Type == token.RBRACE {
+				break
+			}
+			if p.CurrentToken.Type == token.EOF {
+				p.AddErrorAtToken("unterminated match expression", tok)
+				return nil
+			}
+			arm := parseMatchArm(p, arrowTokenType)
+			if arm == nil {
+				return nil
+			}
+			me.Arms = append(me.Arms, arm)
+			if p.PeekToken.Type == token.COMMA {
+				p.NextToken() // consume ','
+			}
+		}
+		me.scanArms()
+		return p.ParseRemainingExpression(me)
+	})
+}
+
+func parseMatchArm(p *parser.Parser, arrowTokenType token.Type) *MatchArm {
+	arm := &MatchArm{Pattern: parseMatchPattern(p)}
+	if arm.Pattern == nil {
+		return nil
+	}
+	if p.PeekToken.Type == token.IF {
+		p.NextToken() // consume 'if'
+		p.NextToken() // move to guard
+		arm.Guard = p.ParseExpression()
+	}
+	if p.PeekToken.Type != arrowTokenType {
+		p.AddErrorAtToken(fmt.Sprintf("expected => after match pattern, got %v", p.PeekToken.Literal), p.PeekToken)
+		return nil
+	}
+	p.NextToken() // consume '=>'
+	p.NextToken() // move to body
+	if p.CurrentToken.Type == token.LBRACE {
+		arm.Block = p.ParseBlockStatement()
+	} else {
+		arm.Body = p.ParseExpression()
+		if arm.Body == nil {
+			return nil
+		}
+	}
+	return arm
+}
+
+func parseMatchPattern(p *parser.Parser) MatchPattern {
+	switch p.CurrentToken.Type {
+	case token.IDENT:
+		if p.CurrentToken.Literal == "_" {
+			return &WildcardPattern{Token: p.CurrentToken}
+		}
+		return &BindingPattern{Name: &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}}
+	case token.STRING:
+		return &LiteralPattern{Value: &ast.StringLiteral{Token: p.CurrentToken, Value: p.CurrentToken.Literal}}
+	case token.TRUE, token.FALSE:
+		return &LiteralPattern{Value: &ast.BooleanLiteral{Token: p.CurrentToken, Value: p.CurrentToken.Type == token.TRUE}}
+	case token.NULL:
+		return &LiteralPattern{Value: &ast.NullLiteral{Token: p.CurrentToken}}
+	case token.INT, token.FLOAT, token.MINUS:
+		low := parseMatchNumber(p)
+		if low == nil {
+			return nil
+		}
+		if p.PeekToken.Type != token.DOT {
+			return &LiteralPattern{Value: low}
+		}
+		p.NextToken() // consume first '.'
+		rp := &RangePattern{Token: p.CurrentToken, Low: low}
+		if !p.ExpectToken(token.DOT) {
+			return nil
+		}
+		p.NextToken() // move to upper bound
+		rp.High = parseMatchNumber(p)
+		if rp.High == nil {
+			return nil
+		}
+		return rp
+	case token.LBRACKET:
+		ap := &ArrayPattern{Token: p.CurrentToken}
+		for p.PeekToken.Type != token.RBRACKET {
+			p.NextToken()
+			elem := parseMatchPattern(p)
+			if elem == nil {
+				return nil
+			}
+			ap.Elements = append(ap.Elements, elem)
+			if p.PeekToken.Type != token.COMMA {
+				break
+			}
+			p.NextToken() // consume ','
+		}
+		if !p.ExpectToken(token.RBRACKET) {
+			return nil
+		}
+		return ap
+	case token.LBRACE:
+		op := &ObjectPattern{Token: p.CurrentToken}
+		for p.PeekToken.Type != token.RBRACE {
+			p.NextToken()
+			var prop ObjectPatternProperty
+			switch p.CurrentToken.Type {
+			case token.IDENT:
+				prop.Key = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			case token.STRING:
+				prop.Key = &ast.StringLiteral{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			default:
+				p.AddError(fmt.Sprintf("expected property name in object pattern, got %v", p.CurrentToken.Literal))
+				return nil
+			}
+			if p.PeekToken.Type == token.COLON {
+				p.NextToken() // consume ':'
+				p.NextToken() // move to pattern
+				prop.Pattern = parseMatchPattern(p)
+				if prop.Pattern == nil {
+					return nil
+				}
+			} else if key, ok := prop.Key.(*ast.Identifier); ok {
+				prop.Pattern = &BindingPattern{Name: key}
+			} else {
+				p.AddError("expected : after string key in object pattern")
+				return nil
+			}
+			op.Properties = append(op.Properties, prop)
+			if p.PeekToken.Type != token.COMMA {
+				break
+			}
+			p.NextToken() // consume ','
+		}
+		if !p.ExpectToken(token.RBRACE) {
+			return nil
+		}
+		return op
+	}
+	p.AddError(fmt.Sprintf("unexpected %v in match pattern", p.CurrentToken.Literal))
+	return nil
+}
+
+// parseMatchNumber parses a numeric literal with an optional minus sign.
+func parseMatchNumber(p *parser.Parser) ast.Expression {
+	if p.CurrentToken.Type == token.MINUS {
+		tok := p.CurrentToken
+		p.NextToken() // consume '-'
+		right := parseMatchNumber(p)
+		if right == nil {
+			return nil
+		}
+		return &ast.UnaryExpression{Token: tok, Operator: "-", Right: right}
+	}
+	switch p.CurrentToken.Type {
+	case token.INT:
+		return &ast.IntegerLiteral{Token: p.CurrentToken}
+	case token.FLOAT:
+		return &ast.FloatLiteral{Token: p.CurrentToken}
+	}
+	p.AddError(fmt.Sprintf("expected number in match pattern, got %v", p.CurrentToken.Literal))
+	return nil
+}
+
+// useArrowToken registers the `=>` token, shared by match arms and async arrow
+// functions. Installing it twice is harmless: the outer interceptor no longer
+// sees the '=' token.
+func useArrowToken(lb *lexer.Builder) token.Type {
+	arrowTokenType := lb.RegisterTokenType("=>")
+
+	// '=' followed by '>' becomes a single ARROW token
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		if ret.Type == token.ASSIGN && l.CurrentChar == '>' {
+			l.ReadChar() // consume '>'
+			ret.Type = arrowTokenType
+			ret.Literal = "=>"
+		}
+		return ret
+	})
+	return arrowTokenType
+}
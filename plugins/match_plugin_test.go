@@ -0,0 +1,190 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestMatchContextualKeyword(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "method named match",
+			input:    `let r = s.match(re).length`,
+			expected: `let r=s.match(re).length`,
+		},
+		{
+			name:     "function named match",
+			input:    `match(a, b)`,
+			expected: `match(a,b)`,
+		},
+		{
+			name: "call followed by a new statement",
+			input: `let x = match(y)
+			foo()`,
+			expected: `let x=match(y);foo()`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).Install(MatchPlugin).Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `let k = match (x) {
+		0 => 'zero',
+		1..9 if x != 5 => 'digit',
+		[a, _] => a,
+		{code: -1} => 'failed'
+	}`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).Install(MatchPlugin).Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	code := compiler.New().Compile(prog).Code
+	for _, want := range []string{
+		`===0){return "zero"}`,
+		`>=1&&`,
+		`<=9){if((x!=5)){return "digit"}}`,
+		`.length===2){let a=`,
+		`.code===(-1))){return "failed"}`,
+		`throw new Error("non-exhaustive match at line`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, code)
+		}
+	}
+}
+
+func TestMatchErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "missing arrow",
+			input: `let k = match (x) { 0 'zero' }`,
+		},
+		{
+			name:  "invalid pattern",
+			input: `let k = match (x) { a + b => 1 }`,
+		},
+		{
+			name:  "incomplete range",
+			input: `let k = match (x) { 1.. => 1 }`,
+		},
+		{
+			name:  "unterminated match",
+			input: `let k = match (x) { 0 => 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).Install(MatchPlugin).Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Errorf("Expected error for %s, but got none", tt.name)
+			}
+		})
+	}
+}
+
+func TestMatchAwaitAndYield(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+	}{
+		{
+			name: "await in an arm",
+			input: `async function f(x) {
+				return match (x) {
+					0 => await load()
+					_ => 1
+				}
+			}`,
+			contains: []string{`(await (async (match_`, `return await load()`},
+		},
+		{
+			name: "for await in a block arm",
+			input: `async function f(x) {
+				return match (x) {
+					_ => { for await (let l of lines) { log(l) } return 1 }
+				}
+			}`,
+			contains: []string{`(await (async (match_`},
+		},
+		{
+			name: "yield in an arm",
+			input: `function* f(x) {
+				let y = match (x) {
+					0 => yield 1
+					_ => 2
+				}
+			}`,
+			contains: []string{`(yield* (function*(match_`, `.call(this,x))`},
+		},
+		{
+			name: "await and yield in an arm",
+			input: `async function* f(x) {
+				let y = match (x) {
+					_ => yield await next()
+				}
+			}`,
+			contains: []string{`(yield* (async function*(match_`},
+		},
+		{
+			name: "await in a function inside an arm",
+			input: `function f(x) {
+				return match (x) {
+					_ => async function() { await load() }
+				}
+			}`,
+			contains: []string{`return ((match_`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewBuilder(lexer.NewBuilder()).
+				WithSmartSemicolon(true).
+				Install(DeferPlugin).
+				Install(GeneratorPlugin).
+				Install(MatchPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			code := compiler.New().Compile(prog).Code
+			for _, want := range tt.contains {
+				if !strings.Contains(code, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,710 @@
+package plugins
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/rs/xid"
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// ModuleSpecifier is a binding in an import or export list (`name` or
+// `name as alias`).
+type ModuleSpecifier struct {
+	Name  *ast.Identifier // the imported name, or the local name for exports
+	Alias *ast.Identifier // can be nil
+}
+
+// local returns the name bound in the importing module.
+func (ms *ModuleSpecifier) local() *ast.Identifier {
+	if ms.Alias != nil {
+		return ms.Alias
+	}
+	return ms.Name
+}
+
+func (ms *ModuleSpecifier) WriteTo(cw *ast.CodeWriter) {
+	ms.Name.WriteTo(cw)
+	if ms.Alias != nil {
+		cw.WriteString(" as ")
+		ms.Alias.WriteTo(cw)
+	}
+}
+
+// moduleSource is the string literal naming the imported module. Relative
+// `.djs` paths are rewritten to the extension of the emitted files.
+type moduleSource struct {
+	*ast.StringLiteral
+	extension string
+}
+
+func (ms *moduleSource) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ms.Token.Start)
+	cw.WriteRune('"')
+	cw.WriteString(rewriteModulePath(ms.Value, ms.extension))
+	cw.WriteRune('"')
+}
+
+func rewriteModulePath(path, extension string) string {
+	relative := strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+	if relative && strings.HasSuffix(path, ".djs") {
+		return strings.TrimSuffix(path, ".djs") + extension
+	}
+	return path
+}
+
+// ImportDeclaration represents `import x, { a, b as c } from "mod"`,
+// `import * as ns from "mod"` and `import "mod"`.
+type ImportDeclaration struct {
+	Token      token.Token     // the 'import' token
+	Default    *ast.Identifier // can be nil
+	Namespace  *ast.Identifier // can be nil
+	Specifiers []*ModuleSpecifier
+	Source     *moduleSource
+	commonJS   bool
+	prefix     string
+}
+
+func (id *ImportDeclaration) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(id.Token.Start)
+	if id.commonJS {
+		id.writeCommonJS(cw)
+		return
+	}
+	cw.WriteString("import ")
+	if id.Default == nil && id.Namespace == nil && id.Specifiers == nil {
+		id.Source.WriteTo(cw)
+		return
+	}
+	if id.Default != nil {
+		id.Default.WriteTo(cw)
+		if id.Namespace != nil || id.Specifiers != nil {
+			cw.WriteRune(',')
+		}
+	}
+	if id.Namespace != nil {
+		cw.WriteString("* as ")
+		id.Namespace.WriteTo(cw)
+	}
+	if id.Specifiers != nil {
+		cw.WriteRune('{')
+		for i, spec := range id.Specifiers {
+			if i > 0 {
+				cw.WriteRune(',')
+			}
+			spec.WriteTo(cw)
+		}
+		cw.WriteRune('}')
+	}
+	cw.WriteString(" from ")
+	id.Source.WriteTo(cw)
+}
+
+func (id *ImportDeclaration) writeCommonJS(cw *ast.CodeWriter) {
+	if id.Default == nil && id.Namespace == nil && id.Specifiers == nil {
+		cw.WriteString("require(")
+		id.Source.WriteTo(cw)
+		cw.WriteRune(')')
+		return
+	}
+
+	moduleName := "module_" + id.prefix
+	cw.WriteString("let " + moduleName + "=require(")
+	id.Source.WriteTo(cw)
+	cw.WriteRune(')')
+	if id.Default != nil {
+		// modules emitted from `export default` are marked with __esModule,
+		// anything else is imported as a whole
+		cw.WriteString(";let ")
+		id.Default.WriteTo(cw)
+		cw.WriteString("=" + moduleName + "&&" + moduleName + ".__esModule?" + moduleName + ".default:" + moduleName)
+	}
+	if id.Namespace != nil {
+		cw.WriteString(";let ")
+		id.Namespace.WriteTo(cw)
+		cw.WriteString("=" + moduleName)
+	}
+	for _, spec := range id.Specifiers {
+		cw.WriteString(";let ")
+		spec.local().WriteTo(cw)
+		cw.WriteString("=" + moduleName + ".")
+		spec.Name.WriteTo(cw)
+	}
+}
+
+// ImportExpression represents a dynamic `import(source)`.
+type ImportExpression struct {
+	Token     token.Token // the 'import' token
+	Source    ast.Expression
+	extension string
+	require   bool // true if emitted as a promise of require()
+}
+
+func (ie *ImportExpression) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ie.Token.Start)
+	if ie.require {
+		cw.WriteString("Promise.resolve().then(() =>require(")
+	} else {
+		cw.WriteString("import(")
+	}
+	if sl, ok := ie.Source.(*ast.StringLiteral); ok {
+		(&moduleSource{StringLiteral: sl, extension: ie.extension}).WriteTo(cw)
+	} else {
+		ie.Source.WriteTo(cw)
+	}
+	cw.WriteRune(')')
+	if ie.require {
+		cw.WriteRune(')')
+	}
+}
+
+// ExportDeclaration represents `export function f() {}` and `export let x = 1`.
+type ExportDeclaration struct {
+	Token       token.Token // the 'export' token
+	Declaration ast.Statement
+	Name        *ast.Identifier // the declared name
+	commonJS    bool
+}
+
+func (ed *ExportDeclaration) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ed.Token.Start)
+	if !ed.commonJS {
+		cw.WriteString("export ")
+		ed.Declaration.WriteTo(cw)
+		return
+	}
+	ed.Declaration.WriteTo(cw)
+	cw.WriteString(";exports.")
+	ed.Name.WriteTo(cw)
+	cw.WriteRune('=')
+	ed.Name.WriteTo(cw)
+}
+
+// ExportDefaultDeclaration represents `export default expr`.
+type ExportDefaultDeclaration struct {
+	Token       token.Token // the 'export' token
+	Declaration ast.Expression
+	commonJS    bool
+}
+
+func (ed *ExportDefaultDeclaration) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ed.Token.Start)
+	if !ed.commonJS {
+		cw.WriteString("export default ")
+		ed.Declaration.WriteTo(cw)
+		return
+	}
+	// a named function stays visible to the rest of the module
+	name := functionName(ed.Declaration)
+	if name != nil {
+		ed.Declaration.WriteTo(cw)
+		cw.WriteRune(';')
+	}
+	cw.WriteString("Object.defineProperty(exports,\"__esModule\",{value:true});exports.default=")
+	if name != nil {
+		name.WriteTo(cw)
+	} else {
+		ed.Declaration.WriteTo(cw)
+	}
+}
+
+// ExportNamedDeclaration represents `export { a, b as c }`, optionally
+// re-exported from another module.
+type ExportNamedDeclaration struct {
+	Token      token.Token // the 'export' token
+	Specifiers []*ModuleSpecifier
+	Source     *moduleSource // can be nil
+	commonJS   bool
+}
+
+func (ed *ExportNamedDeclaration) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ed.Token.Start)
+	if !ed.commonJS {
+		cw.WriteString("export {")
+		for i, spec := range ed.Specifiers {
+			if i > 0 {
+				cw.WriteRune(',')
+			}
+			spec.WriteTo(cw)
+		}
+		cw.WriteRune('}')
+		if ed.Source != nil {
+			cw.WriteString(" from ")
+			ed.Source.WriteTo(cw)
+		}
+		return
+	}
+	for i, spec := range ed.Specifiers {
+		if i > 0 {
+			cw.WriteRune(';')
+		}
+		cw.WriteString("exports.")
+		spec.local().WriteTo(cw)
+		cw.WriteRune('=')
+		if ed.Source != nil {
+			cw.WriteString("require(")
+			ed.Source.WriteTo(cw)
+			cw.WriteString(").")
+		}
+		spec.Name.WriteTo(cw)
+	}
+}
+
+// ExportAllDeclaration represents `export * from "mod"` and
+// `export * as ns from "mod"`.
+type ExportAllDeclaration struct {
+	Token     token.Token     // the 'export' token
+	Namespace *ast.Identifier // can be nil
+	Source    *moduleSource
+	commonJS  bool
+	prefix    string
+}
+
+func (ed *ExportAllDeclaration) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ed.Token.Start)
+	if !ed.commonJS {
+		cw.WriteString("export *")
+		if ed.Namespace != nil {
+			cw.WriteString(" as ")
+			ed.Namespace.WriteTo(cw)
+		}
+		cw.WriteString(" from ")
+		ed.Source.WriteTo(cw)
+		return
+	}
+	if ed.Namespace != nil {
+		cw.WriteString("exports.")
+		ed.Namespace.WriteTo(cw)
+		cw.WriteString("=require(")
+		ed.Source.WriteTo(cw)
+		cw.WriteRune(')')
+		return
+	}
+	// like `export *`, neither the default export nor local exports are replaced
+	moduleName := "module_" + ed.prefix
+	keyName := "key_" + ed.prefix
+	cw.WriteString("((" + moduleName + ") =>{for(let " + keyName + " in " + moduleName + "){" +
+		"if(" + keyName + "!==\"default\"&&!(" + keyName + " in exports)){exports[" + keyName + "]=" + moduleName + "[" + keyName + "]}}})(require(")
+	ed.Source.WriteTo(cw)
+	cw.WriteString("))")
+}
+
+// awaits reports whether the module body awaits at the top level, either in
+// its statements or to dispose of `use await` resources.
+func (mb *ModuleBody) awaits() bool {
+	for _, stmt := range deferredStatements(mb.Statements) {
+		if us, ok := stmt.(*UseStatement); ok && us.Await {
+			return true
+		}
+	}
+	return mb.Await
+}
+
+// moduleContext is the parsing context of the top-level statements of a
+// module, where `defer` and `use` are also allowed.
+const moduleContext parser.ContextType = 100
+
+// ModuleBody holds the top-level statements of a module. Top-level defers run
+// once the module body completes, including any awaited work.
+type ModuleBody struct {
+	Statements []ast.Statement
+	Await      bool // true if the module uses top-level await
+	commonJS   bool
+	prefix     string
+}
+
+func (mb *ModuleBody) WriteTo(cw *ast.CodeWriter) {
+	deferred := deferredStatements(mb.Statements)
+	awaitDefers := mb.awaits()
+
+	// CommonJS has no top-level await, so the module runs in an async
+	// function whose failure sets the exit code like an uncaught exception
+	asyncBody := mb.commonJS && (mb.Await || awaitDefers)
+	if asyncBody {
+		cw.WriteString("(async () =>{")
+	}
+	writeTemps(cw, scopeTemps(mb))
+
+	statements := mb.Statements
+	if len(deferred) > 0 {
+		if !mb.commonJS {
+			// import declarations can't be nested in the try statement
+			var rest []ast.Statement
+			for _, stmt := range statements {
+				if _, ok := stmt.(*ImportDeclaration); ok {
+					stmt.WriteTo(cw)
+					cw.WriteRune(';')
+				} else {
+					rest = append(rest, stmt)
+				}
+			}
+			statements = rest
+		}
+		writeDeferredBody(cw, deferPrefix(deferred[0]), awaitDefers, func() {
+			cw.WriteRune('{')
+			writeStatements(cw, statements)
+			cw.WriteRune('}')
+		})
+	} else {
+		writeStatements(cw, statements)
+	}
+
+	if asyncBody {
+		errorName := "err_" + mb.prefix
+		cw.WriteString("})().catch((" + errorName + ") =>{console.error(" + errorName + ");process.exitCode=1})")
+	}
+}
+
+func writeStatements(cw *ast.CodeWriter, statements []ast.Statement) {
+	for i, stmt := range statements {
+		if i > 0 {
+			cw.WriteRune(';')
+		}
+		stmt.WriteTo(cw)
+	}
+}
+
+// ModuleDependencies returns the relative `.djs` paths that a program imports
+// or re-exports from, as written in the source. Dynamic imports are not
+// included.
+func ModuleDependencies(program *ast.Program) []string {
+	var paths []string
+	var visit func(statements []ast.Statement)
+	visit = func(statements []ast.Statement) {
+		for _, stmt := range statements {
+			var source *moduleSource
+			switch s := stmt.(type) {
+			case *ModuleBody:
+				visit(s.Statements)
+			case *CommentedStatement:
+				visit([]ast.Statement{s.Statement})
+			case *ImportDeclaration:
+				source = s.Source
+			case *ExportNamedDeclaration:
+				source = s.Source
+			case *ExportAllDeclaration:
+				source = s.Source
+			}
+			if source != nil && rewriteModulePath(source.Value, source.extension) != source.Value {
+				paths = append(paths, source.Value)
+			}
+		}
+	}
+	visit(program.Statements)
+	return paths
+}
+
+// isTopLevel reports whether the parser is at the top level of the program.
+func isTopLevel(p *parser.Parser) bool {
+	ctx := p.CurrentContext()
+	return ctx == parser.GlobalContext || ctx == moduleContext
+}
+
+// ModulesPlugin adds `import` and `export` declarations, dynamic `import()`,
+// top-level await and top-level defers, emitted as ES modules. Relative
+// imports of `.djs` files are rewritten to `.mjs`.
+//
+// The plugin parses the whole program as a ModuleBody, so it must be
+// installed before any other plugin that intercepts statements.
+func ModulesPlugin(pb *parser.Builder) {
+	installModules(pb, false, false)
+}
+
+// CommonJSModulesPlugin is like ModulesPlugin, but declarations are emitted
+// with `require` and `exports`, a module with top-level await runs in an async
+// function, and relative imports of `.djs` files are rewritten to `.js`.
+func CommonJSModulesPlugin(pb *parser.Builder) {
+	installModules(pb, true, false)
+}
+
+// RequireModulesPlugin is like CommonJSModulesPlugin, but dynamic `import()`
+// is emitted as a promise of `require()`, for runtimes that can't parse
+// `import()`, such as the embedded runtime.
+func RequireModulesPlugin(pb *parser.Builder) {
+	installModules(pb, true, true)
+}
+
+func installModules(pb *parser.Builder, commonJS, requireImports bool) {
+	extension := ".mjs"
+	if commonJS {
+		extension = ".js"
+	}
+	awaitToken := pb.LexerBuilder.RegisterTokenType("AWAIT")
+	// the module body being parsed by each parser
+	var bodies sync.Map
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentContext() != parser.GlobalContext {
+			return next()
+		}
+		body := &ModuleBody{commonJS: commonJS, prefix: xid.New().String()}
+		bodies.Store(p, body)
+		defer bodies.Delete(p)
+		p.PushContext(moduleContext)
+		defer p.PopContext()
+
+		var exportToken *token.Token
+		for p.CurrentToken.Type != token.EOF {
+			if isIdent(p.CurrentToken, "export") && exportToken == nil {
+				tok := p.CurrentToken
+				exportToken = &tok
+			}
+			if stmt := p.ParseStatement(); stmt != nil {
+				body.Statements = append(body.Statements, stmt)
+			}
+			p.NextToken()
+		}
+		if body.Await {
+			checkFunctionBody(p, &ast.BlockStatement{Statements: body.Statements}, true)
+		}
+		if !commonJS && exportToken != nil && len(deferredStatements(body.Statements)) > 0 {
+			p.AddErrorAtToken("top-level defer cannot be used in ES modules with export declarations", *exportToken)
+		}
+		return body
+	})
+
+	// top-level `await` expressions and `for await` loops
+	markAwait := func(p *parser.Parser) {
+		if body, ok := bodies.Load(p); ok && !p.IsInFunction() {
+			body.(*ModuleBody).Await = true
+		}
+	}
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type == token.FOR && p.PeekToken.Type == awaitToken {
+			markAwait(p)
+		}
+		return next()
+	})
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type == awaitToken {
+			markAwait(p)
+		}
+		return next()
+	})
+
+	// `import` and `export` are contextual keywords, so properties and
+	// variables with those names keep working
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if !isIdent(p.CurrentToken, "import") || p.PeekToken.Type == token.LPAREN || p.PeekToken.Type == token.DOT {
+			return next()
+		}
+		if !isTopLevel(p) {
+			p.AddError("import declarations can only be used at the top level")
+			return nil
+		}
+
+		stmt := &ImportDeclaration{Token: p.CurrentToken, commonJS: commonJS, prefix: xid.New().String()}
+		if p.PeekToken.Type == token.STRING {
+			p.NextToken() // move to source
+			stmt.Source = &moduleSource{StringLiteral: parseModuleString(p), extension: extension}
+			if !p.ExpectSemicolonASI() {
+				return nil
+			}
+			return stmt
+		}
+
+		if p.PeekToken.Type == token.IDENT {
+			p.NextToken() // move to the default binding
+			stmt.Default = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			if p.PeekToken.Type == token.COMMA {
+				p.NextToken() // consume ','
+				if p.PeekToken.Type != token.MULTIPLY && p.PeekToken.Type != token.LBRACE {
+					p.AddError("expected namespace import or import list after ','")
+					return nil
+				}
+			}
+		}
+		switch p.PeekToken.Type {
+		case token.MULTIPLY:
+			p.NextToken() // consume '*'
+			if !expectContextualKeyword(p, "as") || !p.ExpectToken(token.IDENT) {
+				return nil
+			}
+			stmt.Namespace = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		case token.LBRACE:
+			p.NextToken() // consume '{'
+			stmt.Specifiers = parseModuleSpecifiers(p)
+			if stmt.Specifiers == nil {
+				return nil
+			}
+		}
+		if stmt.Default == nil && stmt.Namespace == nil && stmt.Specifiers == nil {
+			p.AddError("expected import binding or module path after import")
+			return nil
+		}
+
+		if stmt.Source = parseModuleFrom(p, extension); stmt.Source == nil {
+			return nil
+		}
+		if !p.ExpectSemicolonASI() {
+			return nil
+		}
+		return stmt
+	})
+
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if !isIdent(p.CurrentToken, "export") {
+			return next()
+		}
+		if !isTopLevel(p) {
+			p.AddError("export declarations can only be used at the top level")
+			return nil
+		}
+
+		tok := p.CurrentToken
+		switch {
+		case isIdent(p.PeekToken, "default"):
+			p.NextToken() // consume 'default'
+			p.NextToken() // move to the exported value
+			stmt := &ExportDefaultDeclaration{Token: tok, commonJS: commonJS}
+			stmt.Declaration = p.ParseExpression()
+			if stmt.Declaration == nil {
+				return nil
+			}
+			// like declarations, exported functions don't need a semicolon
+			if functionName(stmt.Declaration) == nil && !p.ExpectSemicolonASI() {
+				return nil
+			}
+			return stmt
+		case p.PeekToken.Type == token.LBRACE:
+			p.NextToken() // consume '{'
+			stmt := &ExportNamedDeclaration{Token: tok, commonJS: commonJS}
+			if stmt.Specifiers = parseModuleSpecifiers(p); stmt.Specifiers == nil {
+				return nil
+			}
+			if isIdent(p.PeekToken, "from") {
+				if stmt.Source = parseModuleFrom(p, extension); stmt.Source == nil {
+					return nil
+				}
+			}
+			if !p.ExpectSemicolonASI() {
+				return nil
+			}
+			return stmt
+		case p.PeekToken.Type == token.MULTIPLY:
+			p.NextToken() // consume '*'
+			stmt := &ExportAllDeclaration{Token: tok, commonJS: commonJS, prefix: xid.New().String()}
+			if isIdent(p.PeekToken, "as") {
+				p.NextToken() // consume 'as'
+				if !p.ExpectToken(token.IDENT) {
+					return nil
+				}
+				stmt.Namespace = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+			}
+			if stmt.Source = parseModuleFrom(p, extension); stmt.Source == nil {
+				return nil
+			}
+			if !p.ExpectSemicolonASI() {
+				return nil
+			}
+			return stmt
+		}
+
+		p.NextToken() // move to the declaration
+		decl := p.ParseStatement()
+		if decl == nil {
+			return nil
+		}
+		name := declarationName(decl)
+		if name == nil {
+			p.AddErrorAtToken("export must be followed by a function or let declaration", tok)
+			return nil
+		}
+		return &ExportDeclaration{Token: tok, Declaration: decl, Name: name, commonJS: commonJS}
+	})
+
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if !isIdent(p.CurrentToken, "import") || p.PeekToken.Type != token.LPAREN {
+			return next()
+		}
+		tok := p.CurrentToken
+		p.NextToken() // move to (
+		args := p.ParseExpressionList(token.RPAREN)
+		if args == nil {
+			return nil
+		}
+		if len(args) != 1 {
+			p.AddErrorAtToken("import() expects exactly one argument", tok)
+			return nil
+		}
+		return p.ParseRemainingExpression(&ImportExpression{Token: tok, Source: args[0], extension: extension, require: requireImports})
+	})
+}
+
+// parseModuleSpecifiers parses `{ a, b as c }`. The current token must be `{`.
+func parseModuleSpecifiers(p *parser.Parser) []*ModuleSpecifier {
+	specs := []*ModuleSpecifier{}
+	for p.PeekToken.Type != token.RBRACE {
+		if !p.ExpectToken(token.IDENT) {
+			return nil
+		}
+		spec := &ModuleSpecifier{Name: &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}}
+		if isIdent(p.PeekToken, "as") {
+			p.NextToken() // consume 'as'
+			if !p.ExpectToken(token.IDENT) {
+				return nil
+			}
+			spec.Alias = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+		}
+		specs = append(specs, spec)
+		if p.PeekToken.Type != token.COMMA {
+			break
+		}
+		p.NextToken() // consume ','
+	}
+	if !p.ExpectToken(token.RBRACE) {
+		return nil
+	}
+	return specs
+}
+
+// parseModuleFrom parses `from "path"`.
+func parseModuleFrom(p *parser.Parser, extension string) *moduleSource {
+	if !expectContextualKeyword(p, "from") || !p.ExpectToken(token.STRING) {
+		return nil
+	}
+	return &moduleSource{StringLiteral: parseModuleString(p), extension: extension}
+}
+
+func parseModuleString(p *parser.Parser) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+}
+
+func expectContextualKeyword(p *parser.Parser, name string) bool {
+	if !isIdent(p.PeekToken, name) {
+		p.AddError("expected '" + name + "', got " + p.PeekToken.Literal)
+		return false
+	}
+	p.NextToken()
+	return true
+}
+
+// declarationName returns the name declared by an exported statement, or nil
+// if the statement does not declare anything.
+func declarationName(stmt ast.Statement) *ast.Identifier {
+	switch s := stmt.(type) {
+	case *DeferFunctionDeclaration:
+		return s.Name
+	case *ast.FunctionDeclaration:
+		return s.Name
+	case *LetStatement:
+		return s.Name
+	case *ast.LetStatement:
+		return s.Name
+	}
+	return nil
+}
+
+// functionName returns the name of a function expression, or nil if the
+// expression is not a named function.
+func functionName(exp ast.Expression) *ast.Identifier {
+	switch e := exp.(type) {
+	case *DeferFunctionExpression:
+		return e.Name
+	case *ast.FunctionExpression:
+		return e.Name
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package plugins
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+// modulePrefix matches the unique suffix of generated module variables.
+var modulePrefix = regexp.MustCompile(`_[0-9a-v]{20}`)
+
+func TestModulesESM(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "default import",
+			input:    `import fs from "fs"`,
+			expected: `import fs from "fs"`,
+		},
+		{
+			name:     "named imports",
+			input:    `import { readFile, writeFile as write } from "fs"`,
+			expected: `import {readFile,writeFile as write} from "fs"`,
+		},
+		{
+			name:     "default and named imports",
+			input:    `import lib, { a } from "./lib.djs"`,
+			expected: `import lib,{a} from "./lib.mjs"`,
+		},
+		{
+			name:     "namespace import",
+			input:    `import * as path from "node:path"`,
+			expected: `import * as path from "node:path"`,
+		},
+		{
+			name:     "side-effect import",
+			input:    `import "./setup.djs"`,
+			expected: `import "./setup.mjs"`,
+		},
+		{
+			name:     "non-relative .djs path is kept",
+			input:    `import x from "pkg/file.djs"`,
+			expected: `import x from "pkg/file.djs"`,
+		},
+		{
+			name:     "dynamic import",
+			input:    `import("../plugins/x.djs").then(load)`,
+			expected: `import("../plugins/x.mjs").then(load)`,
+		},
+		{
+			name:     "export function",
+			input:    `export function add(a, b) { return a + b }`,
+			expected: `export function add(a,b){return (a+b)}`,
+		},
+		{
+			name:     "export function with defers",
+			input:    "export function run() {\n defer cleanup()\n work()\n}",
+			expected: `export function run() {let defers_=[];try{defers_.push(() =>{cleanup()});work()}finally{for(let i_=defers_.length;i_>0;i_--){try{defers_[i_-1]()}catch(e_){console.log(e_)}}}}`,
+		},
+		{
+			name:     "export let",
+			input:    `export let version = "1.0"`,
+			expected: `export let version="1.0"`,
+		},
+		{
+			name:     "export list",
+			input:    `export { a, b as c }`,
+			expected: `export {a,b as c}`,
+		},
+		{
+			name:     "re-export",
+			input:    `export { a } from "./a.djs"`,
+			expected: `export {a} from "./a.mjs"`,
+		},
+		{
+			name:     "export all",
+			input:    `export * from "./a.djs"; export * as b from "./b.djs"`,
+			expected: `export * from "./a.mjs";export * as b from "./b.mjs"`,
+		},
+		{
+			name:     "export default expression",
+			input:    `export default { port: 8080 }`,
+			expected: `export default {port:8080}`,
+		},
+		{
+			name:     "export default function",
+			input:    "export default function main() { return 1 }\nmain()",
+			expected: `export default function main(){return 1};main()`,
+		},
+		{
+			name:     "import and export as regular identifiers",
+			input:    `let mod = { import: 1, export: 2 }; mod.import = mod.export`,
+			expected: `let mod={export:2,import:1};mod.import=mod.export`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(ModulesPlugin).
+				Install(DeferPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			code := modulePrefix.ReplaceAllString(result.Code, "_")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestModulesCommonJS(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "default import",
+			input:    `import lib from "./lib.djs"`,
+			expected: `let module_=require("./lib.js");let lib=module_&&module_.__esModule?module_.default:module_`,
+		},
+		{
+			name:     "named and namespace imports",
+			input:    `import { a, b as c } from "m"; import * as ns from "n"`,
+			expected: `let module_=require("m");let a=module_.a;let c=module_.b;let module_=require("n");let ns=module_`,
+		},
+		{
+			name:     "side-effect import",
+			input:    `import "./setup.djs"`,
+			expected: `require("./setup.js")`,
+		},
+		{
+			name:     "dynamic import",
+			input:    `let m = import("./lib.djs")`,
+			expected: `let m=import("./lib.js")`,
+		},
+		{
+			name:     "export function",
+			input:    `export function add(a, b) { return a + b }`,
+			expected: `function add(a,b){return (a+b)};exports.add=add`,
+		},
+		{
+			name:     "export let",
+			input:    `export let version = "1.0"`,
+			expected: `let version="1.0";exports.version=version`,
+		},
+		{
+			name:     "export list",
+			input:    `export { a, b as c }`,
+			expected: `exports.a=a;exports.c=b`,
+		},
+		{
+			name:     "re-export",
+			input:    `export { a as b } from "./a.djs"`,
+			expected: `exports.b=require("./a.js").a`,
+		},
+		{
+			name:     "export namespace",
+			input:    `export * as a from "./a.djs"`,
+			expected: `exports.a=require("./a.js")`,
+		},
+		{
+			name:     "export all",
+			input:    `export * from "./a.djs"`,
+			expected: `((module_) =>{for(let key_ in module_){if(key_!=="default"&&!(key_ in exports)){exports[key_]=module_[key_]}}})(require("./a.js"))`,
+		},
+		{
+			name:     "export default expression",
+			input:    `export default 42`,
+			expected: `Object.defineProperty(exports,"__esModule",{value:true});exports.default=42`,
+		},
+		{
+			name:     "export default named function",
+			input:    `export default function main() { return 1 }`,
+			expected: `function main(){return 1};Object.defineProperty(exports,"__esModule",{value:true});exports.default=main`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(CommonJSModulesPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			code := modulePrefix.ReplaceAllString(result.Code, "_")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestModulesRequireImports(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "dynamic import",
+			input:    `let m = await import("./lib.djs")`,
+			expected: `(async () =>{let m=await Promise.resolve().then(() =>require("./lib.js"))})().catch((err_) =>{console.error(err_);process.exitCode=1})`,
+		},
+		{
+			name:     "computed source",
+			input:    `import(name).then(load)`,
+			expected: `Promise.resolve().then(() =>require(name)).then(load)`,
+		},
+		{
+			name:     "static import",
+			input:    `import "./setup.djs"`,
+			expected: `require("./setup.js")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(RequireModulesPlugin).
+				Install(DeferPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			code := modulePrefix.ReplaceAllString(result.Code, "_")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestModulesTopLevel(t *testing.T) {
+	const runDefers = `finally{for(let i_=defers_.length;i_>0;i_--){try{defers_[i_-1]()}catch(e_){console.log(e_)}}}`
+	const awaitDefers = `finally{for(let i_=defers_.length;i_>0;i_--){try{await defers_[i_-1]()}catch(e_){console.log(e_)}}}`
+	tests := []struct {
+		name     string
+		input    string
+		commonJS bool
+		expected string
+	}{
+		{
+			name:     "CommonJS top-level await",
+			input:    "let config = await load()\nconsole.log(config)",
+			commonJS: true,
+			expected: `(async () =>{let config=await load();console.log(config)})().catch((err_) =>{console.error(err_);process.exitCode=1})`,
+		},
+		{
+			name:     "await inside a function is not top-level",
+			input:    "async function main() { await run() }\nmain()",
+			commonJS: true,
+			expected: `async function main(){await run()};main()`,
+		},
+		{
+			name:     "CommonJS top-level defer",
+			input:    "let db = open()\ndefer db.close()\ndb.query()",
+			commonJS: true,
+			expected: `let defers_=[];try{let db=open();defers_.push(() =>{db.close()});db.query()}` + runDefers,
+		},
+		{
+			name:     "CommonJS top-level defer runs after awaited work",
+			input:    "defer console.log('done')\nawait work()",
+			commonJS: true,
+			expected: `(async () =>{let defers_=[];try{defers_.push(async () =>{console.log("done")});await work()}` + awaitDefers + `})().catch((err_) =>{console.error(err_);process.exitCode=1})`,
+		},
+		{
+			name:     "ES module top-level await",
+			input:    "let config = await load()",
+			expected: `let config=await load()`,
+		},
+		{
+			name:     "ES module top-level defer keeps imports outside",
+			input:    "import fs from 'fs'\nlet f = fs.openSync('x')\ndefer fs.closeSync(f)\nawait work(f)",
+			expected: `import fs from "fs";let defers_=[];try{let f=fs.openSync("x");defers_.push(async () =>{fs.closeSync(f)});await work(f)}` + awaitDefers,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules := ModulesPlugin
+			if tt.commonJS {
+				modules = CommonJSModulesPlugin
+			}
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(modules).
+				Install(DeferPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			code := modulePrefix.ReplaceAllString(result.Code, "_")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestModulesErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "import inside function",
+			input: `function f() { import x from "x" }`,
+		},
+		{
+			name:  "export inside block",
+			input: `if (ok) { export let x = 1 }`,
+		},
+		{
+			name:  "import without from",
+			input: `import x "x"`,
+		},
+		{
+			name:  "import without path",
+			input: `import { a } from b`,
+		},
+		{
+			name:  "unterminated import list",
+			input: `import { a, b from "x"`,
+		},
+		{
+			name:  "namespace import without alias",
+			input: `import * from "x"`,
+		},
+		{
+			name:  "export expression",
+			input: `export x + 1`,
+		},
+		{
+			name:  "dynamic import without argument",
+			input: `import()`,
+		},
+		{
+			name:  "top-level defer with exports",
+			input: "defer cleanup()\nexport let x = 1",
+		},
+		{
+			name:  "defer in a top-level block",
+			input: "if (ok) {\n defer cleanup()\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(ModulesPlugin).
+				Install(DeferPlugin).
+				Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestModuleDependencies(t *testing.T) {
+	input := `import fs from "fs"
+import { open } from "./lib/db.djs"
+import "../setup.djs"
+export * from "./shared.djs"
+export { a as b } from "./a.djs"
+export { c }
+let c = 1
+let m = import("./lazy.djs")
+let data = require("./data.json")`
+	expected := []string{"./lib/db.djs", "../setup.djs", "./shared.djs", "./a.djs"}
+
+	for _, plugin := range []func(*parser.Builder){ModulesPlugin, CommonJSModulesPlugin} {
+		lb := lexer.NewBuilder()
+		p := parser.NewBuilder(lb).
+			WithSmartSemicolon(true).
+			Install(plugin).
+			Build(input)
+		prog, err := p.ParseProgram()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if deps := ModuleDependencies(prog); !reflect.DeepEqual(deps, expected) {
+			t.Errorf("Expected %v, got %v", expected, deps)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/xid"
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// ConditionalExpression represents `test ? consequent : alternate`
+type ConditionalExpression struct {
+	Token      token.Token // the '?' token
+	Test       ast.Expression
+	Consequent ast.Expression
+	Alternate  ast.Expression
+}
+
+func (ce *ConditionalExpression) WriteTo(cw *ast.CodeWriter) {
+	cw.WriteRune('(')
+	ce.Test.WriteTo(cw)
+	cw.AddMapping(ce.Token.Start)
+	cw.WriteRune('?')
+	ce.Consequent.WriteTo(cw)
+	cw.WriteRune(':')
+	ce.Alternate.WriteTo(cw)
+	cw.WriteRune(')')
+}
+
+// conditionalHead is the partial result of parsing `test ? consequent`,
+// completed by the expression interceptor once the ':' is reached.
+type conditionalHead struct {
+	Token      token.Token
+	Test       ast.Expression
+	Consequent ast.Expression
+}
+
+func (ch *conditionalHead) WriteTo(cw *ast.CodeWriter) {
+	ch.Test.WriteTo(cw)
+}
+
+// NullishExpression represents `left ?? right`
+type NullishExpression struct {
+	Token     token.Token // the '??' token
+	Left      ast.Expression
+	Right     ast.Expression
+	downlevel bool
+	prefix    string
+}
+
+func (ne *NullishExpression) WriteTo(cw *ast.CodeWriter) {
+	if !ne.downlevel {
+		cw.WriteRune('(')
+		ne.Left.WriteTo(cw)
+		cw.AddMapping(ne.Token.Start)
+		cw.WriteString("??")
+		ne.Right.WriteTo(cw)
+		cw.WriteRune(')')
+		return
+	}
+	// the right operand is only evaluated when the left one is null or undefined
+	valueName := ne.temps()[0]
+	cw.AddMapping(ne.Token.Start)
+	cw.WriteString("((" + valueName + "=")
+	ne.Left.WriteTo(cw)
+	cw.WriteString(")!==null&&" + valueName + "!==void 0?" + valueName + ":")
+	ne.Right.WriteTo(cw)
+	cw.WriteRune(')')
+}
+
+func (ne *NullishExpression) temps() []string {
+	if !ne.downlevel {
+		return nil
+	}
+	return []string{"nullish_" + ne.prefix}
+}
+
+// NullishAssignmentExpression represents `left ??= value`
+type NullishAssignmentExpression struct {
+	Token     token.Token // the '??=' token
+	Left      ast.Expression
+	Value     ast.Expression
+	downlevel bool
+	prefix    string
+}
+
+func (na *NullishAssignmentExpression) WriteTo(cw *ast.CodeWriter) {
+	if !na.downlevel {
+		na.Left.WriteTo(cw)
+		cw.AddMapping(na.Token.Start)
+		cw.WriteString("??=")
+		na.Value.WriteTo(cw)
+		return
+	}
+	cw.AddMapping(na.Token.Start)
+	cw.WriteRune('(')
+	// the object and the key of a member are evaluated once
+	target := na.Left
+	if me, ok := na.Left.(*ast.MemberExpression); ok {
+		temps := na.temps()
+		ref := *me
+		cw.WriteString(temps[0] + "=")
+		me.Object.WriteTo(cw)
+		cw.WriteRune(',')
+		ref.Object = &ast.Identifier{Token: na.Token, Value: temps[0]}
+		if me.Computed {
+			cw.WriteString(temps[1] + "=")
+			me.Property.WriteTo(cw)
+			cw.WriteRune(',')
+			ref.Property = &ast.Identifier{Token: na.Token, Value: temps[1]}
+		}
+		target = &ref
+	}
+	target.WriteTo(cw)
+	cw.WriteString("!==null&&")
+	target.WriteTo(cw)
+	cw.WriteString("!==void 0?")
+	target.WriteTo(cw)
+	cw.WriteRune(':')
+	target.WriteTo(cw)
+	cw.WriteRune('=')
+	na.Value.WriteTo(cw)
+	cw.WriteRune(')')
+}
+
+func (na *NullishAssignmentExpression) temps() []string {
+	me, ok := na.Left.(*ast.MemberExpression)
+	if !na.downlevel || !ok {
+		return nil
+	}
+	if me.Computed {
+		return []string{"object_" + na.prefix, "key_" + na.prefix}
+	}
+	return []string{"object_" + na.prefix}
+}
+
+// OptionalChainHead marks the `object?.` part of an optional chain. Member
+// and call expressions built on top of it form the rest of the chain, which
+// is short-circuited as a whole when the object is null or undefined.
+type OptionalChainHead struct {
+	Token  token.Token // the '?.' token
+	Object ast.Expression
+	param  string // set in downlevel mode, replaces `object?.` inside the chain
+	member bool   // true for `object?.name`, whose member expression writes the '.'
+}
+
+func (oh *OptionalChainHead) WriteTo(cw *ast.CodeWriter) {
+	if oh.param != "" {
+		cw.WriteString(oh.param)
+		return
+	}
+	oh.Object.WriteTo(cw)
+	cw.AddMapping(oh.Token.Start)
+	if oh.member {
+		cw.WriteRune('?')
+	} else {
+		cw.WriteString("?.")
+	}
+}
+
+// OptionalChain wraps a complete optional chain such as `a?.b.c()` or `a?.[i]`
+type OptionalChain struct {
+	Head       *OptionalChainHead
+	Expression ast.Expression // the chain, built on top of Head
+	ThisObject ast.Expression // the object of a method called optionally, e.g. `a` in `a.b?.()`
+	thisArg    string         // set when a method is called optionally
+}
+
+func (oc *OptionalChain) WriteTo(cw *ast.CodeWriter) {
+	if oc.Head.param == "" {
+		oc.Expression.WriteTo(cw)
+		return
+	}
+	param := oc.Head.param
+	cw.AddMapping(oc.Head.Token.Start)
+	cw.WriteRune('(')
+	if oc.thisArg != "" {
+		cw.WriteString(oc.thisArg + "=")
+		oc.ThisObject.WriteTo(cw)
+		cw.WriteRune(',')
+	}
+	cw.WriteString("(" + param + "=")
+	oc.Head.Object.WriteTo(cw)
+	cw.WriteString(")===null||" + param + "===void 0?void 0:")
+	oc.Expression.WriteTo(cw)
+	cw.WriteRune(')')
+}
+
+func (oc *OptionalChain) temps() []string {
+	if oc.Head.param == "" {
+		return nil
+	}
+	if oc.thisArg != "" {
+		return []string{oc.thisArg, oc.Head.param}
+	}
+	return []string{oc.Head.param}
+}
+
+// scopeTemps returns the temporary variables of the downlevel operators in
+// node, outside of the functions nested in it. The function or module body
+// that contains the operators declares them, so the checks need no function
+// of their own, where `await` and `yield` would not work.
+func scopeTemps(node ast.Node) []string {
+	var names []string
+	walk(node, func(n ast.Node) bool {
+		if isFunction(n) {
+			return false
+		}
+		if t, ok := n.(interface{ temps() []string }); ok {
+			names = append(names, t.temps()...)
+		}
+		return true
+	})
+	return names
+}
+
+// writeTemps declares temporary variables, if there are any.
+func writeTemps(cw *ast.CodeWriter, names []string) {
+	if len(names) > 0 {
+		cw.WriteString("var " + strings.Join(names, ",") + ";")
+	}
+}
+
+// optionalMethodCall is a call on an optional chain head in downlevel mode,
+// which must keep the receiver of the method (`a.b?.()` calls b with this=a)
+type optionalMethodCall struct {
+	*ast.CallExpression
+	thisArg string
+}
+
+func (mc *optionalMethodCall) WriteTo(cw *ast.CodeWriter) {
+	mc.Function.WriteTo(cw)
+	cw.AddMapping(mc.Token.Start)
+	cw.WriteString(".call(" + mc.thisArg)
+	for _, arg := range mc.Arguments {
+		cw.WriteRune(',')
+		arg.WriteTo(cw)
+	}
+	cw.WriteRune(')')
+}
+
+// OperatorsPlugin adds the conditional (`?:`), optional chaining (`?.`) and
+// nullish coalescing (`??`, `??=`) operators.
+func OperatorsPlugin(pb *parser.Builder) {
+	installOperators(pb, false)
+}
+
+// DownlevelOperatorsPlugin is like OperatorsPlugin, but optional chaining and
+// nullish coalescing are emitted as explicit null checks for runtimes that
+// lack native support (Node.js < 14).
+func DownlevelOperatorsPlugin(pb *parser.Builder) {
+	installOperators(pb, true)
+}
+
+func installOperators(pb *parser.Builder, downlevel bool) {
+	// temporaries of downlevel operators are named after the plugin
+	// instance and a counter, so that nested operators don't share them
+	id := xid.New()
+	var count int64
+	prefix := func() string {
+		if !downlevel {
+			return ""
+		}
+		return id.String() + "_" + strconv.FormatInt(atomic.AddInt64(&count, 1), 10)
+	}
+	lb := pb.LexerBuilder
+	questionTokenType := lb.RegisterTokenType("?")
+	optionalTokenType := lb.RegisterTokenType("?.")
+	nullishTokenType := lb.RegisterTokenType("??")
+	nullishAssignTokenType := lb.RegisterTokenType("??=")
+
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		if ret.Type != token.ILLEGAL || ret.Literal != "?" {
+			return ret
+		}
+		switch {
+		case l.CurrentChar == '?':
+			l.ReadChar() // consume second '?'
+			if l.CurrentChar == '=' {
+				l.ReadChar() // consume '='
+				ret.Type = nullishAssignTokenType
+				ret.Literal = "??="
+			} else {
+				ret.Type = nullishTokenType
+				ret.Literal = "??"
+			}
+		case l.CurrentChar == '.' && (l.PeekChar() < '0' || l.PeekChar() > '9'):
+			// `a?.5:1` is a conditional with a decimal number, not optional chaining
+			l.ReadChar() // consume '.'
+			ret.Type = optionalTokenType
+			ret.Literal = "?."
+		default:
+			ret.Type = questionTokenType
+		}
+		return ret
+	})
+
+	// Operators are registered so that the Pratt parser applies the right
+	// precedence. Infix callbacks cannot advance the parser past their right
+	// operand, so `?` and `?.` leave partial nodes that the expression
+	// interceptor below completes.
+	_ = pb.RegisterInfixOperator(questionTokenType, parser.ASSIGNMENT, func(tok token.Token, left ast.Expression, right func() ast.Expression) ast.Expression {
+		return &conditionalHead{Token: tok, Test: left, Consequent: right()}
+	})
+	_ = pb.RegisterInfixOperator(optionalTokenType, parser.MEMBER, func(tok token.Token, left ast.Expression, right func() ast.Expression) ast.Expression {
+		return &OptionalChainHead{Token: tok, Object: left}
+	})
+	_ = pb.RegisterInfixOperator(nullishTokenType, parser.LOGICAL_OR, func(tok token.Token, left ast.Expression, right func() ast.Expression) ast.Expression {
+		return &NullishExpression{Token: tok, Left: left, Right: right(), downlevel: downlevel, prefix: prefix()}
+	})
+	_ = pb.RegisterInfixOperator(nullishAssignTokenType, parser.ASSIGNMENT, func(tok token.Token, left ast.Expression, right func() ast.Expression) ast.Expression {
+		return &NullishAssignmentExpression{Token: tok, Left: left, Value: right(), downlevel: downlevel, prefix: prefix()}
+	})
+
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		exp := next()
+
+		// `a?.b`: the property name has no precedence, so the parser stops
+		// right after the head
+		for {
+			head, ok := exp.(*OptionalChainHead)
+			if !ok {
+				break
+			}
+			if p.PeekToken.Type != token.IDENT {
+				p.AddErrorAtToken("expected property name, ( or [ after ?.", p.PeekToken)
+				return nil
+			}
+			p.NextToken() // move to property
+			head.member = true
+			exp = p.ParseRemainingExpression(&ast.MemberExpression{
+				Token:    head.Token,
+				Object:   head,
+				Property: &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal},
+			})
+		}
+
+		if head, ok := exp.(*conditionalHead); ok {
+			if exp = completeConditional(p, head); exp == nil {
+				return nil
+			}
+		}
+
+		// like in JavaScript, `a ?? b || c` needs parentheses, since `??`
+		// has no precedence relative to `||` and `&&`
+		if ne := mixedNullish(exp); ne != nil {
+			p.AddErrorAtToken("?? cannot be mixed with || or && without parentheses", ne.Token)
+			return nil
+		}
+
+		return wrapOptionalChains(exp, prefix)
+	})
+}
+
+// completeConditional parses the ':' and the alternate of a conditional
+// expression. In `a ? b ? c : d : e`, the `?` operators are right
+// associative, so the head of the inner conditional is found as the test of
+// the outer one's consequent: `(a ? b) ? c`.
+func completeConditional(p *parser.Parser, head *conditionalHead) ast.Expression {
+	if outer, ok := head.Test.(*conditionalHead); ok {
+		head.Test = outer.Consequent
+		if outer.Consequent = completeConditional(p, head); outer.Consequent == nil {
+			return nil
+		}
+		return completeConditional(p, outer)
+	}
+	if p.PeekToken.Type != token.COLON {
+		p.AddErrorAtToken("expected : in conditional expression", p.PeekToken)
+		return nil
+	}
+	p.NextToken() // consume ':'
+	p.NextToken() // move to alternate
+	ce := &ConditionalExpression{
+		Token:      head.Token,
+		Test:       head.Test,
+		Consequent: head.Consequent,
+		Alternate:  p.ParseExpression(),
+	}
+	// `x ??= a ? b : c` assigns the whole conditional
+	if na, ok := ce.Test.(*NullishAssignmentExpression); ok {
+		ce.Test = na.Value
+		na.Value = ce
+		return na
+	}
+	return ce
+}
+
+// mixedNullish returns a `??` expression that has a `||` or `&&` expression
+// as an operand, or is an operand of one, without parentheses. Operands that
+// are not binary or `??` expressions were checked when they were parsed.
+func mixedNullish(exp ast.Expression) *NullishExpression {
+	logical := func(e ast.Expression) bool {
+		be, ok := e.(*ast.BinaryExpression)
+		return ok && (be.Operator == "||" || be.Operator == "&&")
+	}
+	switch e := exp.(type) {
+	case *NullishExpression:
+		if logical(e.Left) || logical(e.Right) {
+			return e
+		}
+		if ne := mixedNullish(e.Left); ne != nil {
+			return ne
+		}
+		return mixedNullish(e.Right)
+	case *ast.BinaryExpression:
+		for _, operand := range []ast.Expression{e.Left, e.Right} {
+			if ne, ok := operand.(*NullishExpression); ok && logical(e) {
+				return ne
+			}
+			if ne := mixedNullish(operand); ne != nil {
+				return ne
+			}
+		}
+	}
+	return nil
+}
+
+// wrapOptionalChains wraps every optional chain found along the left side of
+// exp into an OptionalChain node. Operands on the right side are parsed (and
+// wrapped) separately by the expression interceptor. prefix names the
+// temporaries of each chain in downlevel mode, and returns "" otherwise.
+func wrapOptionalChains(exp ast.Expression, prefix func() string) ast.Expression {
+	switch e := exp.(type) {
+	case *ast.BinaryExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *ast.AssignmentExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *ast.CompoundAssignmentExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *ast.PostfixExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *NullishExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *NullishAssignmentExpression:
+		e.Left = wrapOptionalChains(e.Left, prefix)
+	case *ast.MemberExpression, *ast.CallExpression:
+		// walk down the chain of member accesses and calls looking for a head
+		link := exp
+		for {
+			var inner ast.Expression
+			switch l := link.(type) {
+			case *ast.MemberExpression:
+				inner = l.Object
+			case *ast.CallExpression:
+				inner = l.Function
+			}
+			switch in := inner.(type) {
+			case *OptionalChainHead:
+				in.Object = wrapOptionalChains(in.Object, prefix)
+				p := prefix()
+				if p != "" {
+					in.param = "optional_" + p
+				}
+				oc := &OptionalChain{Head: in, Expression: exp}
+				if call, ok := link.(*ast.CallExpression); ok && p != "" {
+					if method, ok := in.Object.(*ast.MemberExpression); ok {
+						// `a.b?.()` evaluates `a` once and calls b with this=a
+						oc.thisArg = "this_" + p
+						oc.ThisObject = method.Object
+						method.Object = &ast.Identifier{Token: in.Token, Value: oc.thisArg}
+						mc := &optionalMethodCall{CallExpression: call, thisArg: oc.thisArg}
+						if exp == ast.Expression(call) {
+							oc.Expression = mc
+						} else {
+							replaceChainLink(exp, call, mc)
+						}
+					}
+				}
+				return oc
+			case *ast.MemberExpression, *ast.CallExpression:
+				link = in
+				continue
+			}
+			return exp
+		}
+	}
+	return exp
+}
+
+// replaceChainLink replaces target by repl in the chain starting at exp.
+func replaceChainLink(exp, target, repl ast.Expression) {
+	for link := exp; link != nil; {
+		switch l := link.(type) {
+		case *ast.MemberExpression:
+			if l.Object == target {
+				l.Object = repl
+				return
+			}
+			link = l.Object
+		case *ast.CallExpression:
+			if l.Function == target {
+				l.Function = repl
+				return
+			}
+			link = l.Function
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package plugins
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestOperatorsPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "conditional",
+			input:    `let r = a ? b : c`,
+			expected: `let r=(a?b:c)`,
+		},
+		{
+			name:     "conditional with binary test",
+			input:    `x = a + b ? -1 : [2]`,
+			expected: `x=((a+b)?(-1):[2])`,
+		},
+		{
+			name:     "chained conditionals",
+			input:    `y = a ? b : c ? d : e`,
+			expected: `y=(a?b:(c?d:e))`,
+		},
+		{
+			name:     "nested conditional in consequent",
+			input:    `let r = a ? b ? c : d : e`,
+			expected: `let r=(a?(b?c:d):e)`,
+		},
+		{
+			name:     "nested conditionals in consequent and alternate",
+			input:    `r = a ? b ? c : d ? e : f : g`,
+			expected: `r=(a?(b?c:(d?e:f)):g)`,
+		},
+		{
+			name:     "optional member chain",
+			input:    `a?.b.c(d)`,
+			expected: `a?.b.c(d)`,
+		},
+		{
+			name:     "optional index and member",
+			input:    `a?.[0]?.b`,
+			expected: `a?.[0]?.b`,
+		},
+		{
+			name:     "optional call",
+			input:    `a.b?.(1, 2)`,
+			expected: `a.b?.(1,2)`,
+		},
+		{
+			name:     "optional chain in binary expression",
+			input:    `f(x)?.y + 1`,
+			expected: `(f(x)?.y+1)`,
+		},
+		{
+			name:     "nullish coalescing",
+			input:    `x = a ?? b ?? c`,
+			expected: `x=((a??b)??c)`,
+		},
+		{
+			name:     "nullish with parenthesized logical operands",
+			input:    `x = ((a ?? b) || c) ?? e`,
+			expected: `x=(((((a??b))||c))??e)`,
+		},
+		{
+			name:     "nullish assignment of a conditional",
+			input:    `x ??= y ? 1 : 2`,
+			expected: `x??=(y?1:2)`,
+		},
+		{
+			name: "multi-line conditional",
+			input: `let r = ok
+				? 'yes'
+				: 'no'`,
+			expected: `let r=(ok?"yes":"no")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).Install(OperatorsPlugin).Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+// tempName matches the temporaries of downlevel operators, whose names end
+// with the id of the plugin instance and a counter
+var tempName = regexp.MustCompile(`_[0-9a-v]{20}_(\d+)`)
+
+func TestDownlevelOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "optional member",
+			input:    `a?.b.c`,
+			expected: `var optional_1;((optional_1=a)===null||optional_1===void 0?void 0:optional_1.b.c)`,
+		},
+		{
+			name:     "optional method call keeps this",
+			input:    `a.b?.(1)`,
+			expected: `var this_1,optional_1;(this_1=a,(optional_1=this_1.b)===null||optional_1===void 0?void 0:optional_1.call(this_1,1))`,
+		},
+		{
+			name:     "nested optional chains",
+			input:    `a?.b?.c`,
+			expected: `var optional_2,optional_1;((optional_2=((optional_1=a)===null||optional_1===void 0?void 0:optional_1.b))===null||optional_2===void 0?void 0:optional_2.c)`,
+		},
+		{
+			name:     "nullish coalescing",
+			input:    `x = a ?? b`,
+			expected: `var nullish_1;x=((nullish_1=a)!==null&&nullish_1!==void 0?nullish_1:b)`,
+		},
+		{
+			name:     "nullish assignment",
+			input:    `x ??= 1`,
+			expected: `(x!==null&&x!==void 0?x:x=1)`,
+		},
+		{
+			name:     "nullish assignment evaluates the object once",
+			input:    `f().x ??= 1`,
+			expected: `var object_1;(object_1=f(),object_1.x!==null&&object_1.x!==void 0?object_1.x:object_1.x=1)`,
+		},
+		{
+			name:     "nullish assignment evaluates the key once",
+			input:    `a[i++] ??= v`,
+			expected: `var object_1,key_1;(object_1=a,key_1=(i++),object_1[key_1]!==null&&object_1[key_1]!==void 0?object_1[key_1]:object_1[key_1]=v)`,
+		},
+		{
+			name:     "temporaries are declared in the function that uses them",
+			input:    `function f(a) { return a ?? 0 }`,
+			expected: `function f(a){var nullish_1;return ((nullish_1=a)!==null&&nullish_1!==void 0?nullish_1:0)}`,
+		},
+		{
+			name:     "await in nullish operands",
+			input:    `async function f() { return await a() ?? await b() }`,
+			expected: `async function f(){var nullish_1;return ((nullish_1=await a())!==null&&nullish_1!==void 0?nullish_1:await b())}`,
+		},
+		{
+			name:     "yield in nullish operands",
+			input:    `function* g() { x = (yield 1) ?? (yield 2) }`,
+			expected: `function* g(){var nullish_1;x=((nullish_1=(yield 1))!==null&&nullish_1!==void 0?nullish_1:(yield 2))}`,
+		},
+		{
+			name:     "await in optional chains",
+			input:    `async function f() { return (await a())?.[await b()] }`,
+			expected: `async function f(){var optional_1;return ((optional_1=(await a()))===null||optional_1===void 0?void 0:optional_1[await b()])}`,
+		},
+		{
+			name:     "yield in optional chains",
+			input:    `function* g() { x = (yield 1)?.[yield 2] }`,
+			expected: `function* g(){var optional_1;x=((optional_1=(yield 1))===null||optional_1===void 0?void 0:optional_1[yield 2])}`,
+		},
+		{
+			name:     "async arrow with an expression body",
+			input:    `let f = async x => x?.y`,
+			expected: `let f=async (x) =>{var optional_1;return ((optional_1=x)===null||optional_1===void 0?void 0:optional_1.y)}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(CommonJSModulesPlugin).
+				Install(DeferPlugin).
+				Install(GeneratorPlugin).
+				Install(DownlevelOperatorsPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			code := tempName.ReplaceAllString(compiler.New().Compile(prog).Code, "_$1")
+			if code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestOperatorsErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "conditional without alternate",
+			input: `let r = a ? b`,
+		},
+		{
+			name:  "optional chain without property",
+			input: `let r = a?.`,
+		},
+		{
+			name:  "nullish before ||",
+			input: `let r = a ?? b || c`,
+		},
+		{
+			name:  "nullish after ||",
+			input: `let r = a || b ?? c`,
+		},
+		{
+			name:  "nullish before &&",
+			input: `let r = a ?? b && c`,
+		},
+		{
+			name:  "nullish after &&",
+			input: `let r = a && b ?? c`,
+		},
+		{
+			name:  "nullish in a longer chain",
+			input: `f(x + 1 ?? y || z || w)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).Install(OperatorsPlugin).Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Errorf("Expected error for %s, but got none", tt.name)
+			}
+		})
+	}
+}
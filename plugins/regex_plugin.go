@@ -0,0 +1,185 @@
+package plugins
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// RegexLiteral represents a regular expression literal, such as /^v(\d+)/i.
+// The pattern and flags are written exactly as in the source.
+type RegexLiteral struct {
+	Token token.Token // the regex token, including its delimiters and flags
+}
+
+func (rl *RegexLiteral) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(rl.Token.Start)
+	cw.WriteString(rl.Token.Literal)
+}
+
+// RegexPlugin adds regular expression literals:
+//
+//	if (/^v(\d+)/.test(version)) { ... }
+//
+// A '/' starts a regex where a value is expected (at the beginning of an
+// expression, or after an operator, '(', ',' or a keyword such as `return`)
+// and is a division after a value (a name, a literal, ')' or ']'). A ')'
+// that closes the head of an if, while or for statement, and a '}' that
+// closes a block, are followed by a statement, so a '/' after them starts a
+// regex: `if (ok) /x/.test(s)`. A '}' that closes an object literal ends a
+// value: `({}) / 2`.
+func RegexPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	regexToken := lb.RegisterTokenType("REGEX")
+
+	// the state of each lexer, which decides whether a '/' is a division
+	var states sync.Map
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		ret := next()
+		// '/*' starts a comment, whose token is discarded
+		if ret.Type == token.DIVIDE && l.CurrentChar == '*' {
+			return ret
+		}
+		if ret.Type == token.EOF {
+			states.Delete(l)
+			return ret
+		}
+		state, _ := states.LoadOrStore(l, &regexLexer{})
+		rl := state.(*regexLexer)
+		if ret.Type == token.DIVIDE && !rl.endsValue(regexToken) {
+			ret = readRegex(l, ret, regexToken)
+		}
+		rl.push(ret, regexToken)
+		return ret
+	})
+
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != regexToken {
+			return next()
+		}
+		return p.ParseRemainingExpression(&RegexLiteral{Token: p.CurrentToken})
+	})
+}
+
+// regexLexer keeps the tokens of a lexer that decide whether a '/' is a
+// division: the last one, and for each open '(' and '{', whether the matching
+// ')' or '}' ends a value.
+type regexLexer struct {
+	last    *token.Token
+	parens  []bool // true for a call or a group, false for a statement head
+	braces  []bool // true for an object literal, false for a block
+	closing bool   // whether the last token, a ')' or '}', ends a value
+}
+
+func (rl *regexLexer) push(tok token.Token, regexToken token.Type) {
+	switch tok.Type {
+	case token.LPAREN:
+		head := rl.last != nil && (rl.last.Type == token.IF || rl.last.Type == token.WHILE || rl.last.Type == token.FOR)
+		rl.parens = append(rl.parens, !head)
+	case token.LBRACE:
+		rl.braces = append(rl.braces, rl.startsObject(regexToken))
+	case token.RPAREN:
+		rl.closing = popBracket(&rl.parens, true)
+	case token.RBRACE:
+		rl.closing = popBracket(&rl.braces, false)
+	}
+	rl.last = &tok
+}
+
+// popBracket removes the innermost open bracket. When the brackets don't
+// match, it returns unknown.
+func popBracket(open *[]bool, unknown bool) bool {
+	n := len(*open)
+	if n == 0 {
+		return unknown
+	}
+	value := (*open)[n-1]
+	*open = (*open)[:n-1]
+	return value
+}
+
+// startsObject reports whether a '{' after the last token starts an object
+// literal rather than a block.
+func (rl *regexLexer) startsObject(regexToken token.Type) bool {
+	if rl.last == nil || rl.endsValue(regexToken) {
+		return false
+	}
+	switch rl.last.Type {
+	case token.SEMICOLON, token.RPAREN, token.LBRACE, token.RBRACE, token.ELSE:
+		return false
+	}
+	switch rl.last.Literal {
+	case "else", "do", "try", "finally", "=>":
+		return false
+	}
+	return true
+}
+
+// endsValue reports whether a '/' after the last token is a division.
+func (rl *regexLexer) endsValue(regexToken token.Type) bool {
+	if rl.last == nil {
+		return false // the '/' starts the program
+	}
+	switch tok := *rl.last; tok.Type {
+	case token.IDENT:
+		switch tok.Literal {
+		case "typeof", "void", "delete", "in", "instanceof", "case", "do", "else", "yield", "await", "throw", "new":
+			return false
+		}
+		return true
+	case token.RPAREN, token.RBRACE:
+		return rl.closing
+	case token.INT, token.FLOAT, token.STRING, token.RAW_STRING, token.TRUE, token.FALSE, token.NULL,
+		token.RBRACKET, token.INCREMENT, token.DECREMENT, regexToken:
+		return true
+	}
+	return false
+}
+
+// readRegex reads the rest of a regex literal whose opening '/' is tok. A '/'
+// inside a character class or after a backslash doesn't end the pattern.
+func readRegex(l *lexer.Lexer, tok token.Token, regexToken token.Type) token.Token {
+	var text strings.Builder
+	text.WriteByte('/')
+	inClass := false
+	for {
+		switch l.CurrentChar {
+		case 0, '\n':
+			tok.Type = token.ILLEGAL
+			tok.Literal = "unterminated regular expression"
+			return tok
+		case '\\':
+			text.WriteByte(l.CurrentChar)
+			l.ReadChar()
+			if l.CurrentChar == 0 || l.CurrentChar == '\n' {
+				continue
+			}
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				text.WriteByte('/')
+				l.ReadChar() // consume closing '/'
+				for isRegexFlag(l.CurrentChar) {
+					text.WriteByte(l.CurrentChar)
+					l.ReadChar()
+				}
+				tok.Type = regexToken
+				tok.Literal = text.String()
+				return tok
+			}
+		}
+		text.WriteByte(l.CurrentChar)
+		l.ReadChar()
+	}
+}
+
+func isRegexFlag(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
@@ -0,0 +1,155 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "regex method call",
+			input:    `let ok = /^v(\d+)/.test(s)`,
+			expected: `let ok=/^v(\d+)/.test(s)`,
+		},
+		{
+			name:     "regex with flags",
+			input:    `let re = /hello world/gi`,
+			expected: `let re=/hello world/gi`,
+		},
+		{
+			name:     "slash in a character class",
+			input:    `let parts = path.split(/[/\\]/)`,
+			expected: `let parts=path.split(/[/\\]/)`,
+		},
+		{
+			name:     "escaped slash",
+			input:    `let s = url.replace(/\//g, "-")`,
+			expected: `let s=url.replace(/\//g,"-")`,
+		},
+		{
+			name:     "regex at the start of a statement",
+			input:    "/a/.test(x)\nif (y) {}\n/b/.test(y)",
+			expected: `/a/.test(x);if (y){};/b/.test(y)`,
+		},
+		{
+			name:     "regex after return",
+			input:    `function isNum(s) { return /^\d+$/.test(s) }`,
+			expected: `function isNum(s){return /^\d+$/.test(s)}`,
+		},
+		{
+			name:     "division after a name",
+			input:    `let half = total / 2 / count`,
+			expected: `let half=((total/2)/count)`,
+		},
+		{
+			name:     "division after a call and a group",
+			input:    `let r = f(x) / (a + b) / g[0]`,
+			expected: `let r=((f(x)/((a+b)))/g[0])`,
+		},
+		{
+			name:     "regex after an if head",
+			input:    "if (ok) /x/.test(s)",
+			expected: `if (ok)/x/.test(s)`,
+		},
+		{
+			name:     "regex after a while head",
+			input:    "while (c) /re/.exec(s)",
+			expected: `while (c)/re/.exec(s)`,
+		},
+		{
+			name:     "division after a call in an if head",
+			input:    "if (f(x) / 2) /re/.exec(s)",
+			expected: `if ((f(x)/2))/re/.exec(s)`,
+		},
+		{
+			name:     "division after an object literal",
+			input:    "let o = {} / n\nlet r = ({}) / 2",
+			expected: `let o=({}/n);let r=(({})/2)`,
+		},
+		{
+			name:     "regex after a block",
+			input:    "if (y) {}\n/b/.test(y)",
+			expected: `if (y){};/b/.test(y)`,
+		},
+		{
+			name:     "division after a number",
+			input:    `let r = 10 / 4`,
+			expected: `let r=(10/4)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(RegexPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestRegexWithComments(t *testing.T) {
+	input := "let a = x /* half */ / 2\nlet b = /* pattern */ /a*b/\n// trailing / comment\n"
+	expected := `let a=(x/2);let b=/a*b/`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		WithSmartSemicolon(true).
+		Install(RegexPlugin).
+		Install(CommentsPlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	if result.Code != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result.Code)
+	}
+}
+
+func TestRegexErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "unterminated regex",
+			input: `let re = /abc`,
+		},
+		{
+			name:  "regex broken by a line break",
+			input: "let re = /abc\n/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(RegexPlugin).
+				Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
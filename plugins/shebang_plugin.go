@@ -0,0 +1,24 @@
+package plugins
+
+import (
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// ShebangPlugin skips a `#!` line at the very beginning of the input, such as
+// `#!/usr/bin/env djs`, so DJS files can be made executable. The line is not
+// part of the output, and the positions of the following lines are kept.
+func ShebangPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		// the lexer is at the first character of the input
+		if l.Line != 1 || l.Column != 1 || l.CurrentChar != '#' || l.PeekChar() != '!' {
+			return next()
+		}
+		for l.CurrentChar != '\n' && l.CurrentChar != 0 {
+			l.ReadChar()
+		}
+		return l.NextToken()
+	})
+}
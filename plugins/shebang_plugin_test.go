@@ -0,0 +1,79 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "shebang line",
+			input:    "#!/usr/bin/env djs\nconsole.log(1)",
+			expected: "console.log(1)",
+		},
+		{
+			name:     "shebang only",
+			input:    "#!/usr/bin/env djs",
+			expected: "",
+		},
+		{
+			name:     "shebang followed by blank lines",
+			input:    "#!/usr/bin/env djs\n\nlet x = 1\nx",
+			expected: "let x=1;x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewBuilder(lexer.NewBuilder()).
+				WithSmartSemicolon(true).
+				Install(ShebangPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestShebangPositions(t *testing.T) {
+	p := parser.NewBuilder(lexer.NewBuilder()).
+		WithSmartSemicolon(true).
+		Install(ShebangPlugin).
+		Build("#!/usr/bin/env djs\nlet = 1")
+	if _, err := p.ParseProgram(); err == nil {
+		t.Fatal("Expected a syntax error")
+	}
+	if line := p.Errors()[0].Position.Line; line != 2 {
+		t.Errorf("Expected the error on line 2, got line %d", line)
+	}
+}
+
+func TestShebangOnlyAtStart(t *testing.T) {
+	inputs := []string{
+		" #!/usr/bin/env djs",
+		"let x = 1\n#!/usr/bin/env djs",
+	}
+	for _, input := range inputs {
+		p := parser.NewBuilder(lexer.NewBuilder()).
+			WithSmartSemicolon(true).
+			Install(ShebangPlugin).
+			Build(input)
+		if _, err := p.ParseProgram(); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package plugins
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// SpreadElement represents `...value` in a call, an array or an object
+// literal.
+type SpreadElement struct {
+	Token    token.Token // the '...' token
+	Argument ast.Expression
+}
+
+func (se *SpreadElement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(se.Token.Start)
+	cw.WriteString("...")
+	se.Argument.WriteTo(cw)
+}
+
+// ObjectProperty is a property of a SpreadObjectLiteral. Value is nil when
+// Key is a SpreadElement.
+type ObjectProperty struct {
+	Key   ast.Expression
+	Value ast.Expression
+}
+
+// SpreadObjectLiteral is an object literal with spread properties. Unlike
+// ast.ObjectLiteral, its properties are written in source order, since a
+// property overrides the spread properties before it: `{...defaults, port: 80}`
+type SpreadObjectLiteral struct {
+	Token      token.Token // the '{' token
+	Properties []ObjectProperty
+}
+
+func (ol *SpreadObjectLiteral) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ol.Token.Start)
+	cw.WriteRune('{')
+	for i, prop := range ol.Properties {
+		if i > 0 {
+			cw.WriteRune(',')
+		}
+		prop.Key.WriteTo(cw)
+		if prop.Value != nil {
+			cw.WriteRune(':')
+			prop.Value.WriteTo(cw)
+		}
+	}
+	cw.WriteRune('}')
+}
+
+// spreadLexer is the state of SpreadPlugin for a lexer.
+type spreadLexer struct {
+	pending  []token.Token // tokens read ahead, returned by the next calls
+	brackets []token.Type  // the brackets that are open
+}
+
+// SpreadPlugin adds spread elements in calls, arrays and object literals
+// (`fn(...args)`, `[...a, ...b]`, `{...defaults, port: 80}`) and rest
+// parameters (`function log(level, ...messages)`).
+func SpreadPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	spreadToken := lb.RegisterTokenType("...")
+	spreadKeyToken := lb.RegisterTokenType("SPREAD_KEY")
+
+	var states sync.Map
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		v, ok := states.Load(l)
+		if !ok {
+			v = &spreadLexer{}
+			states.Store(l, v)
+		}
+		state := v.(*spreadLexer)
+		if len(state.pending) > 0 {
+			ret := state.pending[0]
+			state.pending = state.pending[1:]
+			return ret
+		}
+		ret := next()
+		switch ret.Type {
+		case token.LBRACE, token.LBRACKET, token.LPAREN:
+			state.brackets = append(state.brackets, ret.Type)
+		case token.RBRACE, token.RBRACKET, token.RPAREN:
+			if len(state.brackets) > 0 {
+				state.brackets = state.brackets[:len(state.brackets)-1]
+			}
+		case token.EOF:
+			states.Delete(l)
+		}
+		if ret.Type != token.DOT || l.CurrentChar != '.' || l.PeekChar() != '.' {
+			return ret
+		}
+		l.ReadChar() // consume second '.'
+		l.ReadChar() // consume third '.'
+		ret.Type = spreadToken
+		ret.Literal = "..."
+		inObject := len(state.brackets) > 0 && state.brackets[len(state.brackets)-1] == token.LBRACE
+
+		following := l.NextToken()
+		switch {
+		case inObject:
+			// a spread property is read as `...: value`, so the object
+			// literal parser reads it as a property
+			ret.Type = spreadKeyToken
+			colon := token.Token{Start: ret.Start, Type: token.COLON, Literal: ":", Line: ret.Line, Column: ret.Column}
+			state.pending = append(state.pending, colon, following)
+		case following.Type == token.IDENT:
+			// a name after '...' is part of the same token, so the function
+			// parsers read a rest parameter as a single parameter name
+			ret.Literal += following.Literal
+		default:
+			state.pending = append(state.pending, following)
+		}
+		return ret
+	})
+
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type == spreadKeyToken {
+			// the argument is the value of the property
+			return &SpreadElement{Token: p.CurrentToken}
+		}
+		if p.CurrentToken.Type != spreadToken {
+			return next()
+		}
+		tok := p.CurrentToken
+		se := &SpreadElement{Token: tok}
+		se.Token.Literal = "..."
+		if name := strings.TrimPrefix(tok.Literal, "..."); name != "" {
+			// parse the name as if it had its own token
+			tok.Type = token.IDENT
+			tok.Literal = name
+			tok.Start.Column += 3
+			tok.Column += 3
+			p.CurrentToken = tok
+		} else {
+			p.NextToken() // move to the argument
+		}
+		se.Argument = p.ParseExpression()
+		if se.Argument == nil {
+			return nil
+		}
+		return se
+	})
+
+	pb.UseExpressionInterceptor(func(p *parser.Parser, next func() ast.Expression) ast.Expression {
+		if p.CurrentToken.Type != token.LBRACE {
+			return next()
+		}
+		obj, ok := p.ParseObjectLiteral().(*ast.ObjectLiteral)
+		if !ok {
+			return nil
+		}
+		return p.ParseRemainingExpression(spreadObject(obj))
+	})
+}
+
+// spreadObject returns an object literal with spread properties as a
+// SpreadObjectLiteral, whose properties are in source order.
+func spreadObject(obj *ast.ObjectLiteral) ast.Expression {
+	props := make([]ObjectProperty, 0, len(obj.Properties))
+	hasSpread := false
+	for key, value := range obj.Properties {
+		if se, ok := key.(*SpreadElement); ok && se.Argument == nil {
+			se.Argument = value
+			props = append(props, ObjectProperty{Key: se})
+			hasSpread = true
+		} else {
+			props = append(props, ObjectProperty{Key: key, Value: value})
+		}
+	}
+	if !hasSpread {
+		return obj
+	}
+	sort.Slice(props, func(i, j int) bool {
+		a, b := keyStart(props[i].Key), keyStart(props[j].Key)
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return &SpreadObjectLiteral{Token: obj.Token, Properties: props}
+}
+
+// keyStart returns the position of a property key, which is the start of its
+// token.
+func keyStart(key ast.Expression) token.Position {
+	v := reflect.Indirect(reflect.ValueOf(key))
+	if v.Kind() != reflect.Struct {
+		return token.Position{}
+	}
+	if f := v.FieldByName("Token"); f.IsValid() && f.Type() == reflect.TypeOf(token.Token{}) {
+		return f.Interface().(token.Token).Start
+	}
+	return token.Position{}
+}
@@ -0,0 +1,124 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestSpreadAndRest(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "spread in a call",
+			input:    `fn(...args)`,
+			expected: `fn(...args)`,
+		},
+		{
+			name:     "spread of an expression",
+			input:    `Math.max(first, ...list.map(f), ...[1, 2])`,
+			expected: `Math.max(first,...list.map(f),...[1,2])`,
+		},
+		{
+			name:     "spread in an array",
+			input:    `let all = [...a, x, ...b]`,
+			expected: `let all=[...a,x,...b]`,
+		},
+		{
+			name:     "spread in an object keeps property order",
+			input:    `let cfg = { port: 80, ...defaults, host: "h" }`,
+			expected: `let cfg={port:80,...defaults,host:"h"}`,
+		},
+		{
+			name:     "rest parameter",
+			input:    `function log(level, ...messages) { console.log(level, ...messages) }`,
+			expected: `function log(level,...messages){console.log(level,...messages)}`,
+		},
+		{
+			name:     "rest parameter in a function expression",
+			input:    `let f = function (...xs) { return xs }`,
+			expected: `let f=function(...xs){return xs}`,
+		},
+		{
+			name:     "objects without spread are unchanged",
+			input:    `let o = { b: 1, a: 2 }`,
+			expected: `let o={a:2,b:1}`,
+		},
+		{
+			name:     "spreads nested in an object",
+			input:    "let o = {\n list: [...xs, 1],\n ...a.b,\n sum: f(...ys),\n ...{ z: 1 }\n}",
+			expected: `let o={list:[...xs,1],...a.b,sum:f(...ys),...{z:1}}`,
+		},
+		{
+			name:     "object spread in a call",
+			input:    `merge({ ...a }, [...b])`,
+			expected: `merge({...a},[...b])`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(SpreadPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestSpreadWithDefer(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "spread object with an async method",
+			input:    `let o = { ...base, async load(...ids) { return ids } }`,
+			expected: `let o={...base,load:async function(...ids){return ids}}`,
+		},
+		{
+			name:     "async arrow with a rest parameter",
+			input:    `let f = async (first, ...rest) => rest`,
+			expected: `let f=async (first,...rest) =>rest`,
+		},
+		{
+			name:     "spread of an awaited value",
+			input:    `async function f() { return [...await load()] }`,
+			expected: `async function f(){return [...await load()]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(DeferPlugin).
+				Install(SpreadPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package plugins
+
+import (
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// shellTag is the built-in `sh` tag. It quotes each interpolated value for a
+// POSIX shell (arrays become a list of quoted words), runs the command and
+// resolves to {stdout, stderr, code}. A non-zero exit rejects with an error
+// carrying the same fields, so an `or` block after `await sh` runs on failure.
+const shellTag = `(async (strings,...values) =>{` +
+	`let cp=await import("node:child_process");` +
+	shellTagBody
+
+// requireShellTag is the `sh` tag for runtimes without `import()`.
+const requireShellTag = `(async (strings,...values) =>{` +
+	`let cp=require("child_process");` +
+	shellTagBody
+
+const shellTagBody = `let quote=(v) =>Array.isArray(v)?v.map(quote).join(" "):"'"+String(v).replace(/'/g,"'\\''")+"'";` +
+	`let command=strings.raw.reduce((acc,s,i) =>acc+quote(values[i-1])+s);` +
+	`return new Promise((resolve,reject) =>{cp.exec(command,(err,stdout,stderr) =>{` +
+	`let result={stdout:stdout,stderr:stderr,code:err?(typeof err.code==="number"?err.code:1):0};` +
+	`if(err){reject(Object.assign(new Error("command failed with exit code "+result.code+": "+command),result))}else{resolve(result)}` +
+	`})})})`
+
+// TaggedTemplate represents a tagged template literal: tag`text ${value}`
+type TaggedTemplate struct {
+	Tag      ast.Expression
+	Quasi    *ast.MultiStringLiteral
+	shellTag string
+}
+
+func (tt *TaggedTemplate) WriteTo(cw *ast.CodeWriter) {
+	if ident, ok := tt.Tag.(*ast.Identifier); ok && ident.Value == "sh" {
+		// a `sh` declared by the program (a variable, parameter, import, or
+		// one from a previous REPL line) wins over the built-in tag. The
+		// runtime resolves the name, so its scoping rules apply as is.
+		cw.AddMapping(ident.Token.Start)
+		cw.WriteString(`(typeof sh!=="undefined"?sh:` + tt.shellTag + ")")
+	} else {
+		tt.Tag.WriteTo(cw)
+	}
+	tt.Quasi.WriteTo(cw)
+}
+
+// TemplatePlugin adds tagged template literals, such as String.raw`C:\dir`,
+// and the built-in `sh` tag, which runs a shell command with its interpolated
+// values escaped:
+//
+//	let result = await sh`git log -1 --format=%s ${branch}` or |err| {
+//	  console.log("git exited with code " + err.code)
+//	}
+func TemplatePlugin(pb *parser.Builder) {
+	installTemplate(pb, shellTag)
+}
+
+// RequireTemplatePlugin is like TemplatePlugin, but the `sh` tag loads
+// child_process with `require()`, for runtimes that can't parse `import()`.
+func RequireTemplatePlugin(pb *parser.Builder) {
+	installTemplate(pb, requireShellTag)
+}
+
+func installTemplate(pb *parser.Builder, shellTag string) {
+	// a template right after an expression is a call to the tag
+	_ = pb.RegisterPostfixOperator(token.RAW_STRING, func(tok token.Token, left ast.Expression) ast.Expression {
+		return &TaggedTemplate{
+			Tag:      left,
+			Quasi:    &ast.MultiStringLiteral{Token: tok, Value: tok.Literal},
+			shellTag: shellTag,
+		}
+	})
+}
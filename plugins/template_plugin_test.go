@@ -0,0 +1,137 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestTaggedTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "identifier tag",
+			input:    "let q = sql`SELECT * FROM users WHERE id = ${id}`",
+			expected: "let q=sql`SELECT * FROM users WHERE id = ${id}`",
+		},
+		{
+			name:     "member tag",
+			input:    "let p = String.raw`C:\\dir`",
+			expected: "let p=String.raw`C:\\dir`",
+		},
+		{
+			name:     "tagged template result is callable",
+			input:    "let s = tag`a`.trim()",
+			expected: "let s=tag`a`.trim()",
+		},
+		{
+			name:     "plain template is unchanged",
+			input:    "let s = `total: ${n}`",
+			expected: "let s=`total: ${n}`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(TemplatePlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestShellTag(t *testing.T) {
+	input := "async function build(dir) {\n let out = await sh`make -C ${dir}` or |err| {\n  return err.code\n }\n return out.stdout\n}"
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		WithSmartSemicolon(true).
+		Install(DeferPlugin).
+		Install(OrPlugin).
+		Install(TemplatePlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	expected := "async function build(dir){let out;try{out=await (typeof sh!==\"undefined\"?sh:" + shellTag + ")`make -C ${dir}`}catch(err){return err.code};return out.stdout}"
+	if result.Code != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result.Code)
+	}
+}
+
+func TestUserDefinedShellTag(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "variable",
+			input: "let sh = function (strings) { return strings.join(\"\") }\nlet out = sh`ls`",
+		},
+		{
+			name:  "parameter",
+			input: "function run(sh) { return sh`ls` }\nlet out = run(function (strings) { return strings.join(\"\") })",
+		},
+		{
+			name:  "function declared after its use",
+			input: "let out = sh`ls`\nfunction sh(strings) { return strings.join(\"\") }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				WithSmartSemicolon(true).
+				Install(RequireTemplatePlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			vm := goja.New()
+			if _, err := vm.RunString(compiler.New().Compile(prog).Code); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if out := vm.Get("out").Export(); out != "ls" {
+				t.Errorf("Expected the user-defined sh to be called, got: %v", out)
+			}
+		})
+	}
+}
+
+func TestRequireShellTag(t *testing.T) {
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		WithSmartSemicolon(true).
+		Install(DeferPlugin).
+		Install(RequireTemplatePlugin).
+		Build("let files = await sh`ls ${dir}`")
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	if strings.Contains(result.Code, "import(") || !strings.Contains(result.Code, `require("child_process")`) {
+		t.Errorf("Expected the sh tag to load child_process with require, got:\n%s", result.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+)
+
+// TryStatement represents a try statement in the AST
+type TryStatement struct {
+	Token        token.Token         // The 'try' token
+	Block        *ast.BlockStatement // The protected block
+	CatchParam   *ast.Identifier     // The catch binding (can be nil)
+	CatchBlock   *ast.BlockStatement // The catch block (can be nil)
+	FinallyBlock *ast.BlockStatement // The finally block (can be nil)
+}
+
+func (ts *TryStatement) WriteTo(cw *ast.CodeWriter) {
+	cw.AddMapping(ts.Token.Start)
+	cw.WriteString("try")
+	ts.Block.WriteTo(cw)
+	if ts.CatchBlock != nil {
+		cw.WriteString("catch")
+		if ts.CatchParam != nil {
+			cw.WriteRune('(')
+			ts.CatchParam.WriteTo(cw)
+			cw.WriteRune(')')
+		}
+		ts.CatchBlock.WriteTo(cw)
+	}
+	if ts.FinallyBlock != nil {
+		cw.WriteString("finally")
+		ts.FinallyBlock.WriteTo(cw)
+	}
+}
+
+// TryPlugin adds support for the 'try/catch/finally' statement
+func TryPlugin(pb *parser.Builder) {
+	lb := pb.LexerBuilder
+	tryTokenType := lb.RegisterTokenType("TRY")
+
+	// Intercept 'try' identifier and convert it to TRY token. 'catch' and
+	// 'finally' stay identifiers, so `promise.catch(fn)` keeps working.
+	lb.UseTokenInterceptor(func(l *lexer.Lexer, next func() token.Token) token.Token {
+		tok := next()
+		if tok.Type == token.IDENT && tok.Literal == "try" {
+			tok.Type = tryTokenType
+		}
+		return tok
+	})
+
+	// Statement interceptor for 'try'
+	pb.UseStatementInterceptor(func(p *parser.Parser, next func() ast.Statement) ast.Statement {
+		if p.CurrentToken.Type != tryTokenType {
+			return next()
+		}
+		stmt := &TryStatement{Token: p.CurrentToken}
+		if !p.ExpectToken(token.LBRACE) {
+			return nil
+		}
+		stmt.Block = p.ParseBlockStatement()
+
+		if isIdent(p.PeekToken, "catch") {
+			p.NextToken() // consume 'catch'
+			// the binding is optional: `catch { ... }`
+			if p.PeekToken.Type == token.LPAREN {
+				p.NextToken() // consume (
+				if !p.ExpectToken(token.IDENT) {
+					return nil
+				}
+				stmt.CatchParam = &ast.Identifier{Token: p.CurrentToken, Value: p.CurrentToken.Literal}
+				if !p.ExpectToken(token.RPAREN) {
+					return nil
+				}
+			}
+			if !p.ExpectToken(token.LBRACE) {
+				return nil
+			}
+			stmt.CatchBlock = p.ParseBlockStatement()
+		}
+
+		if isIdent(p.PeekToken, "finally") {
+			p.NextToken() // consume 'finally'
+			if !p.ExpectToken(token.LBRACE) {
+				return nil
+			}
+			stmt.FinallyBlock = p.ParseBlockStatement()
+		}
+
+		if stmt.CatchBlock == nil && stmt.FinallyBlock == nil {
+			p.AddError("try statement requires a catch or finally block")
+			return nil
+		}
+		return stmt
+	})
+}
+
+func isIdent(tok token.Token, name string) bool {
+	return tok.Type == token.IDENT && tok.Literal == name
+}
@@ -0,0 +1,130 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+)
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "try catch",
+			input:    `try { risky() } catch (err) { console.log(err) }`,
+			expected: `try{risky()}catch(err){console.log(err)}`,
+		},
+		{
+			name:     "optional catch binding",
+			input:    `try { risky() } catch { recover() }`,
+			expected: `try{risky()}catch{recover()}`,
+		},
+		{
+			name:     "try finally",
+			input:    `try { risky() } finally { cleanup() }`,
+			expected: `try{risky()}finally{cleanup()}`,
+		},
+		{
+			name:     "try catch finally",
+			input:    `try { risky() } catch (e) { log(e) } finally { cleanup() }`,
+			expected: `try{risky()}catch(e){log(e)}finally{cleanup()}`,
+		},
+		{
+			name:     "throw inside try",
+			input:    `try { throw new Error("boom") } catch (e) { log(e.message) }`,
+			expected: `try{throw new Error("boom");}catch(e){log(e.message)}`,
+		},
+		{
+			name:     "promise catch and finally methods",
+			input:    `fetch(url).catch(handle).finally(done)`,
+			expected: `fetch(url).catch(handle).finally(done)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				Install(TryPlugin).
+				Install(ThrowPlugin).
+				Install(NewPlugin).
+				Build(tt.input)
+			prog, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			result := compiler.New().Compile(prog)
+			if result.Code != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result.Code)
+			}
+		})
+	}
+}
+
+func TestTryWithDefers(t *testing.T) {
+	input := `function f() {
+		try {
+			defer { console.log("deferred") }
+			return compute()
+		} catch (e) {
+			return null
+		}
+	}`
+	lb := lexer.NewBuilder()
+	p := parser.NewBuilder(lb).
+		Install(DeferPlugin).
+		Install(TryPlugin).
+		Build(input)
+	prog, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result := compiler.New().Compile(prog)
+	// a defer nested in a try block still uses the function's defer stack
+	if !strings.Contains(result.Code, "let defers_") || !strings.Contains(result.Code, "finally{for(") {
+		t.Errorf("Expected defer stack in function, got:\n%s", result.Code)
+	}
+}
+
+func TestTryErrorCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "try without catch or finally",
+			input: `try { risky() }`,
+		},
+		{
+			name:  "try without block",
+			input: `try risky()`,
+		},
+		{
+			name:  "catch without block",
+			input: `try { risky() } catch (e) log(e)`,
+		},
+		{
+			name:  "catch with invalid binding",
+			input: `try { risky() } catch (1) { }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := parser.NewBuilder(lb).
+				Install(TryPlugin).
+				Build(tt.input)
+			_, err := p.ParseProgram()
+			if err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
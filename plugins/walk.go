@@ -0,0 +1,61 @@
+package plugins
+
+import (
+	"reflect"
+
+	"github.com/xjslang/xjs/ast"
+)
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// walk calls visit for node and the nodes it contains, depth first. When
+// visit returns false, the nodes inside the node are skipped. Nodes are found
+// through the exported fields of AST structs, including the keys and values
+// of object literals, so nodes of every plugin are covered.
+func walk(node ast.Node, visit func(ast.Node) bool) {
+	walkValue(reflect.ValueOf(node), visit, map[uintptr]bool{})
+}
+
+func walkValue(v reflect.Value, visit func(ast.Node) bool, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkValue(v.Elem(), visit, seen)
+		}
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		if v.Type().Implements(nodeType) && !visit(v.Interface().(ast.Node)) {
+			return
+		}
+		walkValue(v.Elem(), visit, seen)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				walkValue(v.Field(i), visit, seen)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			walkValue(v.Index(i), visit, seen)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkValue(iter.Key(), visit, seen)
+			walkValue(iter.Value(), visit, seen)
+		}
+	}
+}
+
+// isFunction reports whether a node is a function, whose body is a scope of
+// its own for `await`, `yield` and `return`.
+func isFunction(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.FunctionDeclaration, *ast.FunctionExpression, *DeferFunctionDeclaration, *DeferFunctionExpression, *AsyncArrowFunction:
+		return true
+	}
+	return false
+}
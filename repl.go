@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/repl"
+)
+
+const replHelp = `.break    Discard the entry being typed
+.exit     Exit the REPL
+.help     Show this help
+
+Entries with unclosed braces, brackets or parentheses continue on the next
+line. Ctrl+C stops a running entry, and Ctrl+D exits.`
+
+// runREPL implements `djs repl`, which evaluates DJS entries interactively in
+// an embedded JavaScript VM.
+func runREPL(args []string) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	var stripAsserts bool
+	fs.BoolVar(&stripAsserts, "strip-asserts", false, "Ignore assert statements")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: djs repl [options]")
+		fmt.Fprintln(os.Stderr, "\nEvaluates DJS interactively. Entries run in an embedded JavaScript VM, so")
+		fmt.Fprintln(os.Stderr, "Node.js modules are not available.")
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Error: repl takes no arguments")
+		fs.Usage()
+		return 2
+	}
+
+	session := repl.New(djsbuilder.Options{StripAsserts: stripAsserts}, os.Stdout, os.Stderr)
+
+	// prompts are only shown to a terminal, so piped input prints results only
+	interactive := isTerminal(os.Stdin)
+	prompt := func(continued bool) {
+		if !interactive {
+			return
+		}
+		if continued {
+			fmt.Fprint(os.Stdout, "... ")
+		} else {
+			fmt.Fprint(os.Stdout, "> ")
+		}
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if interactive {
+		fmt.Fprintln(os.Stdout, "DJS REPL. Type .help for more information.")
+	}
+	var entry []string
+	for {
+		prompt(len(entry) > 0)
+		var line string
+		select {
+		case <-interrupts:
+			// the terminal discards the line being typed
+			entry = nil
+			fmt.Fprintln(os.Stdout, "\n(To exit, press Ctrl+D or type .exit)")
+			continue
+		case l, ok := <-lines:
+			if !ok {
+				if interactive {
+					fmt.Fprintln(os.Stdout)
+				}
+				return 0
+			}
+			line = l
+		}
+
+		switch strings.TrimSpace(line) {
+		case ".exit":
+			return 0
+		case ".break":
+			entry = nil
+			continue
+		case ".help":
+			if len(entry) == 0 {
+				fmt.Fprintln(os.Stdout, replHelp)
+				continue
+			}
+		}
+		entry = append(entry, line)
+		input := strings.Join(entry, "\n")
+		if repl.Incomplete(input) {
+			continue
+		}
+		entry = nil
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		result, err := evalInterruptible(session, input, interrupts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if result != "" {
+			fmt.Fprintln(os.Stdout, result)
+		}
+	}
+}
+
+// evalInterruptible evaluates an entry, stopping it on Ctrl+C.
+func evalInterruptible(session *repl.Session, input string, interrupts <-chan os.Signal) (string, error) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-interrupts:
+			session.Interrupt()
+		case <-done:
+		}
+	}()
+	result, err := session.Eval(input)
+	close(done)
+	<-finished
+	session.ClearInterrupt()
+	return result, err
+}
@@ -0,0 +1,403 @@
+// Package repl evaluates DJS entries one at a time in a persistent goja VM,
+// for the interactive `djs repl` command.
+package repl
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/xjslang/xjs/ast"
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+	"github.com/xjslang/xjs/parser"
+	"github.com/xjslang/xjs/token"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/plugins"
+)
+
+// Session is a REPL session. Variables and functions declared by an entry
+// are visible to the entries that follow.
+type Session struct {
+	vm       *goja.Runtime
+	opts     djsbuilder.Options
+	declared map[string]bool
+}
+
+// New returns a session whose console writes to stdout and stderr.
+func New(opts djsbuilder.Options, stdout, stderr io.Writer) *Session {
+	// entries run as scripts, so top-level await is handled by Eval rather
+	// than by the CommonJS async wrapper, which needs Node's process object
+	opts.Module = djsbuilder.ModuleESM
+	s := &Session{vm: goja.New(), opts: opts, declared: map[string]bool{}}
+	print := func(w io.Writer) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			parts := make([]string, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				if str, ok := arg.Export().(string); ok {
+					parts[i] = str
+				} else {
+					parts[i] = s.Inspect(arg)
+				}
+			}
+			fmt.Fprintln(w, strings.Join(parts, " "))
+			return goja.Undefined()
+		}
+	}
+	console := s.vm.NewObject()
+	_ = console.Set("log", print(stdout))
+	_ = console.Set("info", print(stdout))
+	_ = console.Set("debug", print(stdout))
+	_ = console.Set("warn", print(stderr))
+	_ = console.Set("error", print(stderr))
+	_ = s.vm.Set("console", console)
+	return s
+}
+
+// ParseError is returned by Eval when an entry has syntax errors.
+type ParseError struct {
+	Source string
+	Errors []parser.ParserError
+}
+
+// Error shows each error under the source line it refers to, with a marker
+// at its column.
+func (pe *ParseError) Error() string {
+	lines := strings.Split(pe.Source, "\n")
+	var sb strings.Builder
+	for i, perr := range pe.Errors {
+		if i > 0 {
+			sb.WriteRune('\n')
+		}
+		if line := perr.Position.Line - 1; line >= 0 && line < len(lines) {
+			text := lines[line]
+			sb.WriteString(text)
+			sb.WriteRune('\n')
+			// tabs are kept, so the marker lines up with the source
+			for col := 0; col < perr.Position.Column-1; col++ {
+				if col < len(text) && text[col] == '\t' {
+					sb.WriteRune('\t')
+				} else {
+					sb.WriteRune(' ')
+				}
+			}
+			sb.WriteString("^\n")
+		}
+		fmt.Fprintf(&sb, "%d:%d: %s", perr.Position.Line, perr.Position.Column, perr.Message)
+	}
+	return sb.String()
+}
+
+// Eval transpiles and runs an entry, and returns the value of its last
+// expression statement, formatted by Inspect. It returns an empty string
+// when the entry has no value.
+func (s *Session) Eval(input string) (string, error) {
+	program, err := s.parse(input)
+	if err != nil {
+		return "", err
+	}
+	if len(program.Statements) == 0 {
+		return "", nil
+	}
+	body, ok := program.Statements[0].(*plugins.ModuleBody)
+	if !ok || len(body.Statements) == 0 {
+		return "", nil
+	}
+
+	names, async, perr := s.rewrite(body)
+	if perr != nil {
+		return "", &ParseError{Source: input, Errors: []parser.ParserError{*perr}}
+	}
+	if len(names) > 0 {
+		if _, err := s.vm.RunString("let " + strings.Join(names, ",")); err != nil {
+			return "", s.runtimeError(err)
+		}
+		for _, name := range names {
+			s.declared[name] = true
+		}
+	}
+
+	js := compiler.New().Compile(program).Code
+	if async {
+		js = "(async () =>{" + js + "})()"
+	}
+	value, err := s.vm.RunString(js)
+	if err != nil {
+		return "", s.runtimeError(err)
+	}
+	if async {
+		// pending jobs run before RunString returns, so the promise is
+		// settled unless it waits for something that never happens
+		if promise, ok := value.Export().(*goja.Promise); ok {
+			switch promise.State() {
+			case goja.PromiseStateRejected:
+				return "", fmt.Errorf("Uncaught %s", s.Inspect(promise.Result()))
+			case goja.PromiseStateFulfilled:
+				value = promise.Result()
+			}
+		}
+	}
+	if goja.IsUndefined(value) {
+		return "", nil
+	}
+	return s.Inspect(value), nil
+}
+
+// parse parses an entry. Like in the Node.js REPL, an entry in braces is an
+// object literal when it parses as one, rather than a block.
+func (s *Session) parse(input string) (*ast.Program, error) {
+	if trimmed := strings.TrimSpace(input); strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		p := djsbuilder.NewWithOptions(lexer.NewBuilder(), s.opts).Build("(" + trimmed + ")")
+		if program, err := p.ParseProgram(); err == nil {
+			return program, nil
+		}
+	}
+	p := djsbuilder.NewWithOptions(lexer.NewBuilder(), s.opts).Build(input)
+	program, err := p.ParseProgram()
+	if err != nil {
+		return nil, &ParseError{Source: input, Errors: p.Errors()}
+	}
+	return program, nil
+}
+
+// rewrite turns the top-level declarations of an entry into assignments to
+// variables declared at the top level of the session, because the body of an
+// entry with defers or top-level await is nested in a block or a function.
+// It returns the names that were not declared yet, and whether the entry must
+// run in an async function.
+func (s *Session) rewrite(body *plugins.ModuleBody) (names []string, async bool, perr *parser.ParserError) {
+	seen := map[string]bool{}
+	declare := func(name *ast.Identifier) {
+		if !s.declared[name.Value] && !seen[name.Value] {
+			seen[name.Value] = true
+			names = append(names, name.Value)
+		}
+	}
+	async = body.Await
+	var functions, statements []ast.Statement
+	for _, stmt := range body.Statements {
+		switch st := stmt.(type) {
+		case *plugins.ImportDeclaration:
+			return nil, false, unsupported("import declarations are not supported in the REPL", st.Token)
+		case *plugins.ExportDeclaration:
+			return nil, false, unsupported("export declarations are not supported in the REPL", st.Token)
+		case *plugins.ExportDefaultDeclaration:
+			return nil, false, unsupported("export declarations are not supported in the REPL", st.Token)
+		case *plugins.ExportNamedDeclaration:
+			return nil, false, unsupported("export declarations are not supported in the REPL", st.Token)
+		case *plugins.ExportAllDeclaration:
+			return nil, false, unsupported("export declarations are not supported in the REPL", st.Token)
+		case *plugins.UseStatement:
+			// resources are released when the entry completes
+			async = async || st.Await
+			statements = append(statements, st)
+		case *ast.LetStatement:
+			declare(st.Name)
+			statements = append(statements, assignment(st))
+		case *plugins.LetStatement:
+			declare(st.Name)
+			statements = append(statements, assignment(st.LetStatement))
+		case *ast.FunctionDeclaration:
+			// assigned first, so they are hoisted like declarations
+			declare(st.Name)
+			functions = append(functions, &functionAssignment{Name: st.Name, Function: st})
+		case *plugins.DeferFunctionDeclaration:
+			declare(st.Name)
+			functions = append(functions, &functionAssignment{Name: st.Name, Function: st})
+		default:
+			statements = append(statements, st)
+		}
+	}
+
+	// the value of the entry is the value of its last expression statement
+	last := len(statements) - 1
+	if expr := expressionOf(body.Statements[len(body.Statements)-1]); expr != nil {
+		if async {
+			statements[last] = &ast.ReturnStatement{ReturnValue: expr}
+		}
+	} else if !async {
+		statements = append(statements, &ast.ExpressionStatement{Expression: &ast.Identifier{Value: "undefined"}})
+	}
+	body.Statements = append(functions, statements...)
+	return names, async, nil
+}
+
+func unsupported(message string, tok token.Token) *parser.ParserError {
+	return &parser.ParserError{
+		Message:  message,
+		Position: parser.Position{Line: tok.Line, Column: tok.Column},
+		Code:     "SYNTAX_ERROR",
+	}
+}
+
+// assignment turns `let x = value` into `x = value`, keeping `or` fallbacks.
+func assignment(ls *ast.LetStatement) ast.Statement {
+	value := ls.Value
+	if value == nil {
+		value = &ast.Identifier{Value: "undefined"}
+	}
+	if oe, ok := value.(*plugins.OrExpression); ok {
+		return &plugins.ExpressionStatement{ExpressionStatement: &ast.ExpressionStatement{
+			Token: ls.Token,
+			Expression: &plugins.OrExpression{
+				Token:         oe.Token,
+				Expression:    &ast.AssignmentExpression{Token: ls.Token, Left: ls.Name, Value: oe.Expression},
+				ErrorParam:    oe.ErrorParam,
+				FallbackBlock: oe.FallbackBlock,
+			},
+		}}
+	}
+	return &ast.ExpressionStatement{
+		Token:      ls.Token,
+		Expression: &ast.AssignmentExpression{Token: ls.Token, Left: ls.Name, Value: value},
+	}
+}
+
+// expressionOf returns the expression of an expression statement, or nil if
+// the statement is anything else.
+func expressionOf(stmt ast.Statement) ast.Expression {
+	switch st := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return st.Expression
+	case *plugins.ExpressionStatement:
+		if _, ok := st.Expression.(*plugins.OrExpression); !ok {
+			return st.Expression
+		}
+	}
+	return nil
+}
+
+// functionAssignment assigns a function declaration, written as a function
+// expression, to the variable of the same name.
+type functionAssignment struct {
+	Name     *ast.Identifier
+	Function ast.Statement
+}
+
+func (fa *functionAssignment) WriteTo(cw *ast.CodeWriter) {
+	fa.Name.WriteTo(cw)
+	cw.WriteRune('=')
+	fa.Function.WriteTo(cw)
+}
+
+func (s *Session) runtimeError(err error) error {
+	switch e := err.(type) {
+	case *goja.Exception:
+		return fmt.Errorf("Uncaught %s", s.Inspect(e.Value()))
+	case *goja.InterruptedError:
+		return fmt.Errorf("interrupted")
+	}
+	return err
+}
+
+// Interrupt stops the entry being evaluated, if any. It is safe to call from
+// another goroutine.
+func (s *Session) Interrupt() {
+	s.vm.Interrupt("interrupted")
+}
+
+// ClearInterrupt must be called after an interrupt, before the next entry.
+func (s *Session) ClearInterrupt() {
+	s.vm.ClearInterrupt()
+}
+
+// Inspect formats a value for display: strings are quoted, and objects and
+// arrays are shown as JSON when possible.
+func (s *Session) Inspect(value goja.Value) string {
+	if value == nil || goja.IsUndefined(value) {
+		return "undefined"
+	}
+	if goja.IsNull(value) {
+		return "null"
+	}
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		if str, ok := value.Export().(string); ok {
+			return strconv.Quote(str)
+		}
+		return value.String()
+	}
+	if _, ok := goja.AssertFunction(obj); ok {
+		if name := obj.Get("name"); name != nil && name.String() != "" {
+			return "[Function: " + name.String() + "]"
+		}
+		return "[Function (anonymous)]"
+	}
+	switch obj.ClassName() {
+	case "Error", "RegExp", "Date":
+		return obj.String()
+	case "Promise":
+		if promise, ok := obj.Export().(*goja.Promise); ok {
+			switch promise.State() {
+			case goja.PromiseStatePending:
+				return "Promise { <pending> }"
+			case goja.PromiseStateRejected:
+				return "Promise { <rejected> " + s.Inspect(promise.Result()) + " }"
+			}
+			return "Promise { " + s.Inspect(promise.Result()) + " }"
+		}
+	}
+	stringify, _ := goja.AssertFunction(s.vm.Get("JSON").ToObject(s.vm).Get("stringify"))
+	if str, err := stringify(goja.Undefined(), obj); err == nil && !goja.IsUndefined(str) {
+		return str.String()
+	}
+	return obj.String()
+}
+
+// Incomplete reports whether an entry has unclosed brackets, braces,
+// parentheses, template literals or block comments, so the REPL reads more
+// lines before evaluating it.
+func Incomplete(input string) bool {
+	depth := 0
+	for i := 0; i < len(input); i++ {
+		switch ch := input[i]; ch {
+		case '"', '\'', '`':
+			end := closingQuote(input, i+1, ch)
+			if end < 0 {
+				// only template literals span lines
+				return ch == '`'
+			}
+			i = end
+		case '/':
+			if strings.HasPrefix(input[i:], "//") {
+				end := strings.IndexByte(input[i:], '\n')
+				if end < 0 {
+					return depth > 0
+				}
+				i += end
+			} else if strings.HasPrefix(input[i:], "/*") {
+				end := strings.Index(input[i+2:], "*/")
+				if end < 0 {
+					return true
+				}
+				i += end + 3
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// closingQuote returns the index of the quote that closes a string started
+// before i, or -1 if the string is not closed.
+func closingQuote(input string, i int, quote byte) int {
+	for ; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '\n':
+			if quote != '`' {
+				return -1
+			}
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
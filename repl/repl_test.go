@@ -0,0 +1,148 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		results []string
+		output  string
+	}{
+		{
+			name:    "variables carry across entries",
+			entries: []string{"let x = 40", "x + 2", "let x = 1", "x"},
+			results: []string{"", "42", "", "1"},
+		},
+		{
+			name:    "functions are hoisted",
+			entries: []string{"let r = double(2)\nfunction double(n) { return n * 2 }", "r", "double(5)"},
+			results: []string{"", "4", "10"},
+		},
+		{
+			name:    "defers run when the entry completes",
+			entries: []string{"let y = 1\ndefer console.log(\"deferred\", y)\nconsole.log(\"body\")", "y"},
+			results: []string{"", "1"},
+			output:  "body\ndeferred 1\n",
+		},
+		{
+			name:    "or fallbacks",
+			entries: []string{"let v = JSON.parse(\"{\") or { v = \"fallback\" }", "v"},
+			results: []string{"", `"fallback"`},
+		},
+		{
+			name:    "top-level await",
+			entries: []string{"let n = await Promise.resolve(3)", "await Promise.resolve(n * 2)", "n"},
+			results: []string{"", "6", "3"},
+		},
+		{
+			name:    "async functions and defers",
+			entries: []string{"async function load() {\n  defer console.log(\"closed\")\n  return [1, 2]\n}", "await load()"},
+			results: []string{"", "[1,2]"},
+			output:  "closed\n",
+		},
+		{
+			name:    "blocks",
+			entries: []string{"{ let z = 1\n console.log(z) }"},
+			results: []string{""},
+			output:  "1\n",
+		},
+		{
+			name:    "values",
+			entries: []string{"\"hi\"", "{a: 1}", "null", "function f() {}", "f", "/a+/g"},
+			results: []string{`"hi"`, `{"a":1}`, "null", "", "[Function: f]", "/a+/g"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			s := New(djsbuilder.Options{}, &stdout, &stderr)
+			for i, entry := range tt.entries {
+				result, err := s.Eval(entry)
+				if err != nil {
+					t.Fatalf("Eval(%q) failed: %v", entry, err)
+				}
+				if result != tt.results[i] {
+					t.Errorf("Eval(%q) = %q, want %q", entry, result, tt.results[i])
+				}
+			}
+			if stdout.String() != tt.output {
+				t.Errorf("output = %q, want %q", stdout.String(), tt.output)
+			}
+		})
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		err   string
+	}{
+		{
+			name:  "parse error with a column marker",
+			entry: "let x = (1 +",
+			err:   "let x = (1 +\n            ^\n1:13:",
+		},
+		{
+			name:  "import declarations",
+			entry: "import fs from \"fs\"",
+			err:   "import fs from \"fs\"\n      ^\n1:7: import declarations are not supported in the REPL",
+		},
+		{
+			name:  "uncaught exception",
+			entry: "throw new Error(\"boom\")",
+			err:   "Uncaught Error: boom",
+		},
+		{
+			name:  "rejected top-level await",
+			entry: "await Promise.reject(new TypeError(\"bad\"))",
+			err:   "Uncaught TypeError: bad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			s := New(djsbuilder.Options{}, &stdout, &stderr)
+			_, err := s.Eval(tt.entry)
+			if err == nil {
+				t.Fatalf("Eval(%q) succeeded, want error", tt.entry)
+			}
+			if !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("error = %q, want prefix %q", err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"let x = 1", false},
+		{"function f() {", true},
+		{"function f() {\n  return [1,\n", true},
+		{"function f() {\n}", false},
+		{"let s = \"{\"", false},
+		{"let s = `line\n", true},
+		{"let s = `a ${b}`", false},
+		{"/* comment", true},
+		{"x // {", false},
+		{"if (a) { // }", true},
+	}
+
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.want {
+			t.Errorf("Incomplete(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultGracePeriod is how long a program has to exit after djs forwards a
+// signal to it, like the default of docker stop.
+const defaultGracePeriod = 10 * time.Second
+
+// forwardedSignals are passed on to the Node.js process, so a program stopped
+// by a supervisor such as systemd or docker can shut down cleanly.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// runChild runs a program and returns its exit code. Signals received by djs
+// are forwarded to it, and if it hasn't exited within the grace period, it is
+// killed.
+func runChild(cmd *exec.Cmd, grace time.Duration) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	c, err := startChild(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Execution error: %v\n", err)
+		return 1
+	}
+	return c.wait(nil, signals, grace)
+}
+
+// child is a running program.
+type child struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed when the program has exited
+	err  error         // the result of cmd.Wait, once done is closed
+}
+
+func startChild(cmd *exec.Cmd) (*child, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &child{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		c.err = cmd.Wait()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// wait waits for the program to exit and returns its exit code. sig, if it
+// isn't nil, and the signals received on signals are forwarded to it, and
+// once one is, the program is killed if it hasn't exited within the grace
+// period.
+func (c *child) wait(sig os.Signal, signals <-chan os.Signal, grace time.Duration) int {
+	// Ctrl+C in a terminal interrupts the whole process group, so the program
+	// has the signal already
+	interactive := isTerminal(os.Stdin)
+	var kill <-chan time.Time
+	for {
+		if sig != nil && (sig != os.Interrupt || !interactive) {
+			_ = c.cmd.Process.Signal(sig)
+			if kill == nil {
+				kill = time.After(grace)
+			}
+		}
+		sig = nil
+		select {
+		case <-c.done:
+			return childExitCode(c.err)
+		case sig = <-signals:
+		case <-kill:
+			fmt.Fprintf(os.Stderr, "[djs] the program did not exit within %s, killing it\n", grace)
+			_ = c.cmd.Process.Kill()
+		}
+	}
+}
+
+// signalExitCode is the exit code of djs when it stops on a signal, like in a
+// shell.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// childExitCode returns the exit code of a program. A program ended by a
+// signal exits with 128 plus the signal number, like in a shell.
+func childExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintf(os.Stderr, "Execution error: %v\n", err)
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return signalExitCode(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,155 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildProject(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	out := filepath.Join(root, "dist")
+	writeFiles(t, src, map[string]string{
+		"main.djs":            "import { add } from \"./lib/math.djs\"\nconsole.log(add(1, 2))\n",
+		"lib/math.djs":        "export function add(a, b) { return a + b }\n",
+		"lib/data.json":       "{\"a\": 1}\n",
+		"broken/one.djs":      "let x = (\n",
+		"broken/two.djs":      "let y = ]\n",
+		".cache/skip.djs":     "let z = 1\n",
+		"node_modules/m/i.js": "module.exports = 1\n",
+	})
+
+	result, err := djsbuilder.Build(src, out, djsbuilder.BuildOptions{SourceMap: true})
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	if result.Files != 2 || result.Assets != 1 {
+		t.Errorf("Expected 2 files and 1 asset, got %d and %d", result.Files, result.Assets)
+	}
+
+	// errors of every file are reported, sorted by file
+	var files []string
+	for _, ferr := range result.Errors {
+		files = append(files, filepath.Base(ferr.File))
+	}
+	if len(files) < 2 || files[0] != "one.djs" || files[len(files)-1] != "two.djs" {
+		t.Errorf("Expected errors for one.djs and two.djs, got %v", files)
+	}
+
+	for _, name := range []string{"main.js", "main.js.map", "lib/math.js", "lib/math.js.map", "lib/data.json"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("Expected %s in the output: %v", name, err)
+		}
+	}
+	for _, name := range []string{"broken/one.js", ".cache/skip.js", "node_modules/m/i.js"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err == nil {
+			t.Errorf("Expected no %s in the output", name)
+		}
+	}
+
+	main, err := os.ReadFile(filepath.Join(out, "main.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(main), `require("./lib/math.js")`) {
+		t.Errorf("Expected the import to be rewritten to math.js:\n%s", main)
+	}
+	if !strings.HasSuffix(string(main), "//# sourceMappingURL=main.js.map\n") {
+		t.Errorf("Expected a source map reference:\n%s", main)
+	}
+	sm, err := os.ReadFile(filepath.Join(out, "lib", "math.js.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(sm), `"sources":["../../src/lib/math.djs"]`) {
+		t.Errorf("Expected a relative source in the source map:\n%s", sm)
+	}
+}
+
+func TestBuildProjectSymlinks(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	out := filepath.Join(root, "dist")
+	writeFiles(t, root, map[string]string{
+		"shared/logo.svg": "<svg/>\n",
+		"src/main.djs":    "console.log(1)\n",
+	})
+	for name, target := range map[string]string{
+		"logo.svg":    filepath.Join(root, "shared", "logo.svg"),
+		"shared":      filepath.Join(root, "shared"),
+		"missing.txt": filepath.Join(root, "missing.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(src, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	result, err := djsbuilder.Build(src, out, djsbuilder.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	if result.Files != 1 || result.Assets != 1 {
+		t.Errorf("Expected 1 file and 1 asset, got %d and %d", result.Files, result.Assets)
+	}
+	// the broken link is reported instead of being skipped silently
+	if len(result.Errors) != 1 || filepath.Base(result.Errors[0].File) != "missing.txt" || result.Errors[0].Code != djsbuilder.ErrorCodeIO {
+		t.Errorf("Expected an error for missing.txt, got %+v", result.Errors)
+	}
+	logo, err := os.ReadFile(filepath.Join(out, "logo.svg"))
+	if err != nil || string(logo) != "<svg/>\n" {
+		t.Errorf("Expected the symlinked file to be copied, got %q: %v", logo, err)
+	}
+	if info, err := os.Lstat(filepath.Join(out, "logo.svg")); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		t.Error("Expected a copy of the symlink target, not a symlink")
+	}
+	if _, err := os.Stat(filepath.Join(out, "shared")); err == nil {
+		t.Error("Expected the symlinked directory not to be followed")
+	}
+}
+
+func TestBuildProjectESM(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	// an output directory inside the source tree is not built again
+	out := filepath.Join(src, "dist")
+	writeFiles(t, src, map[string]string{
+		"main.djs": "import { add } from \"./math.djs\"\nconsole.log(add(1, 2))\n",
+		"math.djs": "export function add(a, b) { return a + b }\n",
+	})
+
+	for i := 0; i < 2; i++ {
+		result, err := djsbuilder.Build(src, out, djsbuilder.BuildOptions{
+			Options: djsbuilder.Options{Module: djsbuilder.ModuleESM},
+		})
+		if err != nil {
+			t.Fatalf("Build error: %v", err)
+		}
+		if len(result.Errors) > 0 || result.Files != 2 || result.Assets != 0 {
+			t.Fatalf("Unexpected result: %+v", result)
+		}
+	}
+	main, err := os.ReadFile(filepath.Join(out, "main.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(main), `"./math.mjs"`) || strings.Contains(string(main), "sourceMappingURL") {
+		t.Errorf("Unexpected output:\n%s", main)
+	}
+}
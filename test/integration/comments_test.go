@@ -0,0 +1,52 @@
+package integration
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// TestPreserveComments runs the comment test cases with license headers and
+// JSDoc blocks kept in the output, which must behave exactly the same.
+func TestPreserveComments(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(testDataDir, "comments", "*.djs"))
+	if err != nil {
+		t.Fatalf("Failed to list comment test cases: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("No comment test cases found")
+	}
+
+	for _, input := range inputs {
+		rel, _ := filepath.Rel(testDataDir, input)
+		test := loadTestCase(t, strings.TrimSuffix(rel, ".djs"))
+		t.Run(test.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := djsbuilder.NewWithOptions(lb, djsbuilder.Options{PreserveComments: true}).Build(test.inputFile)
+			program, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("ParseProgram error: %v", err)
+			}
+			code := compiler.New().Compile(program).Code
+			for _, comment := range []string{"/*!", "@param {number} width"} {
+				if !strings.Contains(code, comment) {
+					t.Errorf("Expected %q in output:\n%s", comment, code)
+				}
+			}
+
+			actualOutput, err := executeJavaScript(code)
+			if err != nil {
+				t.Fatalf("JavaScript execution failed: %v\n%s", err, code)
+			}
+			if actualOutput != test.expectedOutput {
+				t.Errorf("Output mismatch:\nExpected: %q\nActual:   %q\nTranspiled JS:\n%s",
+					test.expectedOutput, actualOutput, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package integration
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xjslang/xjs/compiler"
+	"github.com/xjslang/xjs/lexer"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+)
+
+// TestDownlevelOperators runs the operator test cases with downlevel output,
+// which must behave exactly like the native operators.
+func TestDownlevelOperators(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(testDataDir, "operators", "*.djs"))
+	if err != nil {
+		t.Fatalf("Failed to list operator test cases: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("No operator test cases found")
+	}
+
+	for _, input := range inputs {
+		rel, _ := filepath.Rel(testDataDir, input)
+		test := loadTestCase(t, strings.TrimSuffix(rel, ".djs"))
+		t.Run(test.name, func(t *testing.T) {
+			lb := lexer.NewBuilder()
+			p := djsbuilder.NewWithOptions(lb, djsbuilder.Options{Downlevel: true}).Build(test.inputFile)
+			program, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("ParseProgram error: %v", err)
+			}
+			code := compiler.New().Compile(program).Code
+			for _, op := range []string{"?.", "??"} {
+				if strings.Contains(code, op) {
+					t.Errorf("Expected no %q in downlevel output:\n%s", op, code)
+				}
+			}
+
+			actualOutput, err := executeJavaScript(code)
+			if err != nil {
+				t.Fatalf("JavaScript execution failed: %v\n%s", err, code)
+			}
+			if actualOutput != test.expectedOutput {
+				t.Errorf("Output mismatch:\nExpected: %q\nActual:   %q\nTranspiled JS:\n%s",
+					test.expectedOutput, actualOutput, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildDJS builds the djs command into a temporary directory.
+func buildDJS(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "djs")
+	cmd := exec.Command("go", "build", "-o", bin, "github.com/xjslang/djs")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Building djs failed: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestRunFromStdinResolvesFromWorkingDirectory(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found")
+	}
+	djs := buildDJS(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"answer.js":  "module.exports = 41\n",
+		"lib/m.djs":  "export function inc(n) { return n + 1 }\n",
+		"answer.mjs": "export default 41\n",
+	})
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+	}{
+		{
+			name:  "CommonJS",
+			input: "import { inc } from \"./lib/m.djs\"\nlet answer = require(\"./answer\")\nconsole.log(inc(answer))\n",
+		},
+		{
+			name:  "ES modules",
+			args:  []string{"--module", "esm"},
+			input: "import { inc } from \"./lib/m.djs\"\nimport answer from \"./answer.mjs\"\nconsole.log(inc(answer))\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(djs, tt.args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "XDG_CACHE_HOME="+t.TempDir())
+			cmd.Stdin = strings.NewReader(tt.input)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v\n%s", err, out)
+			}
+			if string(out) != "42\n" {
+				t.Errorf("Expected 42, got:\n%s", out)
+			}
+		})
+	}
+}
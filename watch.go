@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	djsbuilder "github.com/xjslang/djs/builder"
+	"github.com/xjslang/djs/watch"
+)
+
+// Files are polled every watchInterval, and changes are handled once the
+// files stay unchanged for watchDebounce.
+const (
+	watchInterval = 250 * time.Millisecond
+	watchDebounce = 100 * time.Millisecond
+)
+
+// runWatch runs a DJS file like execute mode, and restarts it whenever the
+// file or one of the .djs files it imports changes. The program is stopped
+// like djs stops it in execute mode: with SIGTERM on restarts, or the signal
+// djs receives, and it is killed if it hasn't exited within the grace period.
+func runWatch(node nodeOptions, absInputPath string, opts djsbuilder.Options, args []string, grace time.Duration) int {
+	graph := newModuleGraph(absInputPath, opts)
+
+	in := watchInterrupts()
+	defer in.close()
+	w := &watch.Watcher{Interval: watchInterval, Debounce: watchDebounce, List: graph.files}
+	for {
+		w.Snapshot()
+		var child *watchedProcess
+		if graph.report() && node.supports(graph.features()) {
+			if err := graph.compile(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing compiled JS: %v\n", err)
+				return 1
+			}
+			cmd, err := nodeCommand(node, absInputPath, "", opts, args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the Node.js loader: %v\n", err)
+				return 1
+			}
+			child = startWatchedProcess(cmd)
+		} else {
+			fmt.Fprintln(os.Stderr, "[djs] waiting for changes")
+		}
+
+		changed := w.Wait(in.stop)
+		if changed == nil {
+			if child != nil && child.running() {
+				// later signals are forwarded while the program exits
+				return child.stop(in.signal, in.signals, grace)
+			}
+			return signalExitCode(in.signal)
+		}
+		if child != nil {
+			child.stop(syscall.SIGTERM, nil, grace)
+		}
+		fmt.Fprintf(os.Stderr, "[djs] %s changed, restarting\n", strings.Join(relativeNames(changed), ", "))
+		graph.invalidate(changed)
+	}
+}
+
+// watchedProcess is a child process that watch mode restarts.
+type watchedProcess struct {
+	*child
+	stopped atomic.Bool
+	exited  chan struct{} // closed once the exit is reported
+}
+
+func startWatchedProcess(cmd *exec.Cmd) *watchedProcess {
+	wp := &watchedProcess{exited: make(chan struct{})}
+	c, err := startChild(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Execution error: %v\n", err)
+		close(wp.exited)
+		return wp
+	}
+	wp.child = c
+	go func() {
+		defer close(wp.exited)
+		<-c.done
+		if !wp.stopped.Load() {
+			fmt.Fprintf(os.Stderr, "[djs] exited with code %d, waiting for changes\n", childExitCode(c.err))
+		}
+	}()
+	return wp
+}
+
+// running reports whether the process is still running.
+func (wp *watchedProcess) running() bool {
+	select {
+	case <-wp.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop sends sig to the process, if it is still running, and waits for it
+// to exit, forwarding the signals received on signals. It returns the exit
+// code of the process.
+func (wp *watchedProcess) stop(sig os.Signal, signals <-chan os.Signal, grace time.Duration) int {
+	wp.stopped.Store(true)
+	defer func() { <-wp.exited }()
+	if wp.child == nil {
+		return 1
+	}
+	return wp.wait(sig, signals, grace)
+}
+
+// interrupts stops watch mode when djs receives one of the forwarded
+// signals.
+type interrupts struct {
+	stop    chan struct{}  // closed when the first signal is received
+	signal  os.Signal      // the first signal, once stop is closed
+	signals chan os.Signal // the signals received after the first one
+}
+
+func watchInterrupts() *interrupts {
+	in := &interrupts{stop: make(chan struct{}), signals: make(chan os.Signal, 1)}
+	signal.Notify(in.signals, forwardedSignals...)
+	go func() {
+		in.signal = <-in.signals
+		close(in.stop)
+	}()
+	return in
+}
+
+func (in *interrupts) close() {
+	signal.Stop(in.signals)
+}
+
+// relativeNames returns paths relative to the working directory, when
+// possible, for shorter messages.
+func relativeNames(paths []string) []string {
+	wd, _ := os.Getwd()
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = path
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			names[i] = rel
+		}
+	}
+	return names
+}
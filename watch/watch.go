@@ -0,0 +1,97 @@
+// Package watch polls files for changes, so that watch mode works the same
+// on every platform without filesystem notification APIs.
+package watch
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// Watcher reports the files that were modified, created or removed.
+type Watcher struct {
+	// Interval is how often the files are polled.
+	Interval time.Duration
+	// Debounce is how long the files must stay unchanged before the changes
+	// are reported, so a burst of editor writes is reported once.
+	Debounce time.Duration
+	// List returns the files to watch. It is called on every poll, so the set
+	// of files can change over time.
+	List func() []string
+
+	stamps map[string]stamp
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Snapshot records the current state of the files, which later changes are
+// compared to. Wait takes a snapshot itself when none was taken.
+func (w *Watcher) Snapshot() {
+	w.stamps = w.scan()
+}
+
+// Wait blocks until some files change and then stay unchanged for the
+// debounce period, and returns the changed files, sorted. It returns nil
+// when stop is closed.
+func (w *Watcher) Wait(stop <-chan struct{}) []string {
+	if w.stamps == nil {
+		w.Snapshot()
+	}
+	changed := map[string]bool{}
+	var lastChange time.Time
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case now := <-ticker.C:
+			current := w.scan()
+			if diff := compare(w.stamps, current); len(diff) > 0 {
+				for _, path := range diff {
+					changed[path] = true
+				}
+				lastChange = now
+			}
+			w.stamps = current
+			if len(changed) > 0 && now.Sub(lastChange) >= w.Debounce {
+				paths := make([]string, 0, len(changed))
+				for path := range changed {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				return paths
+			}
+		}
+	}
+}
+
+func (w *Watcher) scan() map[string]stamp {
+	stamps := map[string]stamp{}
+	for _, path := range w.List() {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // a removed file is reported as changed
+		}
+		stamps[path] = stamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps
+}
+
+func compare(before, after map[string]stamp) []string {
+	var diff []string
+	for path, s := range after {
+		if old, ok := before[path]; !ok || old != s {
+			diff = append(diff, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			diff = append(diff, path)
+		}
+	}
+	return diff
+}
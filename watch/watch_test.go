@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.djs")
+	b := filepath.Join(dir, "b.djs")
+	c := filepath.Join(dir, "c.djs")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte("let x = 1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []string{a, b, c}
+	w := &Watcher{
+		Interval: 5 * time.Millisecond,
+		Debounce: 50 * time.Millisecond,
+		List:     func() []string { return files },
+	}
+	w.Snapshot()
+
+	// a burst of writes is reported once, after the debounce period
+	go func() {
+		for i := 0; i < 5; i++ {
+			_ = os.WriteFile(a, []byte("let x = "+string(rune('2'+i))+"0"), 0o644)
+			time.Sleep(10 * time.Millisecond)
+		}
+		_ = os.Remove(b)
+		_ = os.WriteFile(c, []byte("let y = 1"), 0o644)
+	}()
+
+	start := time.Now()
+	changed := w.Wait(nil)
+	if !reflect.DeepEqual(changed, []string{a, b, c}) {
+		t.Errorf("Expected %v, got %v", []string{a, b, c}, changed)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected changes to be debounced, reported after %v", elapsed)
+	}
+}
+
+func TestWatcherStop(t *testing.T) {
+	w := &Watcher{
+		Interval: 5 * time.Millisecond,
+		Debounce: 5 * time.Millisecond,
+		List:     func() []string { return nil },
+	}
+	stop := make(chan struct{})
+	close(stop)
+	if changed := w.Wait(stop); changed != nil {
+		t.Errorf("Expected no changes, got %v", changed)
+	}
+}